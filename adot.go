@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// adotAccount publishes the AWS Distro for OpenTelemetry collector layers
+const adotAccount = "901920570463"
+
+// adotReleaseRe matches ADOT collector release numbers
+var adotReleaseRe = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// adotLayer returns ARN (without version) of the ADOT collector layer of the
+// release, like 0.102.1, for the region and Go arch, see
+// https://aws-otel.github.io/docs/getting-started/lambda/lambda-go
+func adotLayer(region, arch, release string) string {
+	return "arn:aws:lambda:" + region + ":" + adotAccount + ":layer:aws-otel-collector-" + arch +
+		"-ver-" + strings.ReplaceAll(release, ".", "-")
+}
+
+// enableADOT attaches the latest version of the ADOT collector layer of the
+// args.adot release to the function, replacing the collector layer it
+// already has, if any. Unless set already, it also sets OTEL_SERVICE_NAME
+// environment variable to the function name, and switches tracing to Active
+// (if -tracing flag is not set), as collector exports traces to X-Ray.
+func (t *target) enableADOT(ctx context.Context, args *runArgs) error {
+	if t.imageRepo != "" {
+		return errors.New("container image must include the ADOT collector itself")
+	}
+	layer := adotLayer(t.awsCfg.Region, t.arch, args.adot)
+	collectors := "arn:aws:lambda:" + t.awsCfg.Region + ":" + adotAccount + ":layer:aws-otel-collector-"
+	var layers []string
+	var current int64
+	for _, l := range t.cfg.Layers {
+		arn := aws.ToString(l.Arn)
+		switch {
+		case strings.HasPrefix(arn, layer+":"):
+			current, _ = strconv.ParseInt(arn[len(layer)+1:], 10, 64)
+		case strings.HasPrefix(arn, collectors):
+		default:
+			layers = append(layers, arn)
+		}
+	}
+	latest, err := latestLayerVersion(ctx, t.svc, layer, current)
+	if err != nil {
+		return err
+	}
+	in := new(lambda.UpdateFunctionConfigurationInput)
+	var changes []string
+	if latest != layer+":"+strconv.FormatInt(current, 10) || len(layers)+1 != len(t.cfg.Layers) {
+		changes = append(changes, "attach layer "+latest)
+		in.Layers = append(layers, latest)
+	}
+	var vars map[string]string
+	if t.cfg.Environment != nil {
+		vars = t.cfg.Environment.Variables
+	}
+	if _, ok := vars["OTEL_SERVICE_NAME"]; !ok {
+		if _, ok := args.env["OTEL_SERVICE_NAME"]; !ok {
+			changes = append(changes, "set OTEL_SERVICE_NAME environment variable")
+			vars = maps.Clone(vars)
+			if vars == nil {
+				vars = make(map[string]string)
+			}
+			vars["OTEL_SERVICE_NAME"] = aws.ToString(t.cfg.FunctionName)
+			in.Environment = &types.Environment{Variables: vars}
+		}
+	}
+	if args.tracing == "" && t.tracingMode() != types.TracingModeActive {
+		changes = append(changes, "switch tracing to Active")
+		in.TracingConfig = &types.TracingConfig{Mode: types.TracingModeActive}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if args.dryRun {
+		t.logf("dry run, would %s", strings.Join(changes, ", "))
+		return nil
+	}
+	t.logf("enabling ADOT collector: %s", strings.Join(changes, ", "))
+	return t.updateConfiguration(ctx, in)
+}
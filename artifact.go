@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/zip"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// checkBinary verifies that file at path is a 64-bit linux executable built
+// for the given Go arch
+func checkBinary(path, arch string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid linux binary: %w", path, err)
+	}
+	defer f.Close()
+	var want elf.Machine
+	switch arch {
+	case goAmd64:
+		want = elf.EM_X86_64
+	case goArm64:
+		want = elf.EM_AARCH64
+	default:
+		return fmt.Errorf("unsupported arch %q", arch)
+	}
+	if f.Class != elf.ELFCLASS64 {
+		return fmt.Errorf("%s: want 64-bit binary, got %v", path, f.Class)
+	}
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		return fmt.Errorf("%s is not an executable, its ELF type is %v", path, f.Type)
+	}
+	if f.Machine != want {
+		return fmt.Errorf("%s is built for %v, but lambda requires %v", path, f.Machine, want)
+	}
+	return nil
+}
+
+// unzipBinary extracts executable from the zip archive at zipPath into dir,
+// returning path to the extracted file. Archive must either have a single
+// file, or have a file with the binaryName.
+func unzipBinary(zipPath, dir, binaryName string) (string, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	var files []*zip.File
+	for _, f := range zr.File {
+		if f.Mode().IsRegular() {
+			files = append(files, f)
+		}
+	}
+	var zf *zip.File
+	if len(files) == 1 {
+		zf = files[0]
+	} else {
+		for _, f := range files {
+			if f.Name == binaryName {
+				zf = f
+				break
+			}
+		}
+	}
+	if zf == nil {
+		return "", fmt.Errorf("%s: want either a single file, or a file named %q", zipPath, binaryName)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	dst := filepath.Join(dir, path.Base(zf.Name))
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0775)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, rc); err != nil {
+		return "", err
+	}
+	return dst, f.Close()
+}
+
+// dirEntries returns zip entries for all regular files inside dir, placing
+// them under the prefix directory in the archive. Executable files get 0775
+// mode, others get 0664.
+func dirEntries(dir, prefix string) ([]zipEntry, error) {
+	var out []zipEntry
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		var mode fs.FileMode = 0664
+		if fi.Mode()&0111 != 0 {
+			mode = 0775
+		}
+		out = append(out, zipEntry{name: path.Join(prefix, filepath.ToSlash(rel)), path: p, mode: mode})
+		return nil
+	})
+	return out, err
+}
+
+// includeEntries returns zip entries for the list of files and directories in
+// path[:zip/path] form. Without explicit zip path, files and directories are
+// put at the archive root under their own names.
+func includeEntries(includes []string) ([]zipEntry, error) {
+	var out []zipEntry
+	for _, s := range includes {
+		src, dst, _ := strings.Cut(s, ":")
+		fi, err := os.Stat(src)
+		if err != nil {
+			return nil, err
+		}
+		if dst == "" {
+			dst = filepath.Base(src)
+		}
+		dst = path.Clean(strings.TrimPrefix(dst, "/"))
+		if dst == "." || strings.HasPrefix(dst, "../") {
+			return nil, fmt.Errorf("invalid archive path in %q", s)
+		}
+		if fi.IsDir() {
+			entries, err := dirEntries(src, dst)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, entries...)
+			continue
+		}
+		var mode fs.FileMode = 0664
+		if fi.Mode()&0111 != 0 {
+			mode = 0775
+		}
+		out = append(out, zipEntry{name: dst, path: src, mode: mode})
+	}
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// auditLog writes deploy records either to S3 objects under the prefix, or
+// to the DynamoDB table. Records are never overwritten.
+type auditLog struct {
+	cfg    aws.Config
+	bucket string // S3 bucket
+	prefix string // S3 key prefix
+	table  string // DynamoDB table name
+}
+
+// parseAuditLog parses -audit flag value: either s3://bucket/prefix/ URL,
+// or dynamodb:table
+func parseAuditLog(s string) (*auditLog, error) {
+	if rest, ok := strings.CutPrefix(s, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid S3 URL %q, want s3://bucket/prefix/", s)
+		}
+		return &auditLog{bucket: bucket, prefix: prefix}, nil
+	}
+	if table, ok := strings.CutPrefix(s, "dynamodb:"); ok && table != "" {
+		return &auditLog{table: table}, nil
+	}
+	return nil, errors.New("must be either s3://bucket/prefix/ or dynamodb:table")
+}
+
+func (l *auditLog) write(ctx context.Context, rec *deployRecord) error {
+	if l.table != "" {
+		item := map[string]ddbtypes.AttributeValue{
+			"id":              &ddbtypes.AttributeValueMemberS{Value: rec.Function},
+			"function":        &ddbtypes.AttributeValueMemberS{Value: rec.Function},
+			"version":         &ddbtypes.AttributeValueMemberS{Value: rec.Version},
+			"codeSha256":      &ddbtypes.AttributeValueMemberS{Value: rec.CodeSha256},
+			"caller":          &ddbtypes.AttributeValueMemberS{Value: rec.Caller},
+			"start":           &ddbtypes.AttributeValueMemberS{Value: rec.Start.UTC().Format(time.RFC3339)},
+			"durationSeconds": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatFloat(rec.Duration, 'f', 3, 64)},
+		}
+		if rec.Commit != "" {
+			item["commit"] = &ddbtypes.AttributeValueMemberS{Value: rec.Commit}
+			item["dirty"] = &ddbtypes.AttributeValueMemberBOOL{Value: rec.Dirty}
+		}
+		if rec.Branch != "" {
+			item["branch"] = &ddbtypes.AttributeValueMemberS{Value: rec.Branch}
+		}
+		_, err := dynamodb.NewFromConfig(l.cfg).PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           &l.table,
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		})
+		if err != nil {
+			return fmt.Errorf("DynamoDB PutItem: %w", err)
+		}
+		return nil
+	}
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	// function ARN is arn:aws:lambda:region:account:function:name:version
+	parts := strings.Split(rec.Function, ":")
+	key := l.prefix + strings.Join(parts[3:5], "/") + "/" + strings.Join(parts[6:], "/") + ".json"
+	_, err = newS3Client(l.cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &l.bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		return fmt.Errorf("S3 PutObject: %w", err)
+	}
+	return nil
+}
+
+// audit writes the record of the t.version deploy to the audit log
+func (t *target) audit(ctx context.Context, l *auditLog) error {
+	rec, err := t.deployRecord(ctx)
+	if err != nil {
+		return err
+	}
+	return l.write(ctx, rec)
+}
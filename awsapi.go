@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// callAPI makes a SigV4-signed request to the AWS service API at the
+// endpoint, returning the response body, or an error if the response status
+// is not 200 OK. It is used for the few calls to services program otherwise
+// has no use for, instead of bringing in their SDK modules.
+//
+// For form-encoded body the request is a POST, otherwise it is a GET.
+func callAPI(ctx context.Context, cfg aws.Config, service, region, endpoint, form string) ([]byte, error) {
+	if form == "" {
+		return sendAPI(ctx, cfg, service, region, http.MethodGet, endpoint, "", nil)
+	}
+	return sendAPI(ctx, cfg, service, region, http.MethodPost, endpoint,
+		"application/x-www-form-urlencoded; charset=utf-8", []byte(form))
+}
+
+// callJSONAPI is like callAPI, but for the services with JSON APIs: if in is
+// not nil, it is sent as the JSON body of a POST request, and the response
+// is decoded into out
+func callJSONAPI(ctx context.Context, cfg aws.Config, service, region, endpoint string, in, out any) error {
+	method, contentType := http.MethodGet, ""
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+		method, contentType = http.MethodPost, "application/json"
+	}
+	resp, err := sendAPI(ctx, cfg, service, region, method, endpoint, contentType, body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp, out)
+}
+
+func sendAPI(ctx context.Context, cfg aws.Config, service, region, method, endpoint, contentType string, body []byte) ([]byte, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseEndpoint != nil {
+		base, err := url.Parse(*cfg.BaseEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme, u.Host = base.Scheme, base.Host
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), service, region, time.Now()); err != nil {
+		return nil, err
+	}
+	resp, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return respBody, &apiError{status: resp.Status, body: respBody}
+	}
+	return respBody, nil
+}
+
+// apiError is returned by callAPI on response with unexpected status
+type apiError struct {
+	status string
+	body   []byte
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.status, strings.TrimSpace(string(e.body)))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/logging"
+)
+
+// verbosity is set with -v (1) and -vv (2) flags. With 1, debug messages are
+// logged, including AWS SDK retries; with 2, AWS SDK also logs HTTP requests
+// and responses, without bodies.
+var verbosity int
+
+// awsFlags are AWS configuration settings given with the command line flags
+var awsFlags struct {
+	profile     string
+	region      string
+	endpointURL string
+	roleArn     string
+	externalID  string
+	mfaSerial   string
+	credCommand string
+	fips        bool
+	dualStack   bool
+	retryMode   aws.RetryMode
+	maxAttempts int
+	maxBackoff  time.Duration
+}
+
+// registerAWSFlags adds flags configuring access to AWS to fs
+func registerAWSFlags(fs *flag.FlagSet) {
+	fs.StringVar(&awsFlags.profile, "profile", "", "use this shared configuration `profile` instead of the AWS_PROFILE or default one")
+	fs.StringVar(&awsFlags.region, "region", "", "use this AWS `region` instead of the one from the environment or shared configuration")
+	fs.StringVar(&awsFlags.endpointURL, "endpoint-url", "", "send requests to all AWS services to this `URL`, like the LocalStack one")
+	fs.StringVar(&awsFlags.roleArn, "role-arn", "", "assume IAM role with this `ARN` and use its credentials for everything")
+	fs.StringVar(&awsFlags.externalID, "external-id", "", "`ID` to pass when assuming -role-arn role, if its trust policy requires one")
+	fs.StringVar(&awsFlags.mfaSerial, "mfa-serial", "", "serial number or `ARN` of the MFA device to authenticate with when assuming -role-arn role;"+
+		" token code is asked interactively")
+	fs.StringVar(&awsFlags.credCommand, "credential-command", "", "get credentials from the JSON this shell `command` prints,"+
+		" in the same format as the credential_process setting of the shared configuration expects")
+	fs.BoolVar(&awsFlags.fips, "fips", false, "use FIPS 140-2 validated endpoints of AWS services (also AWS_USE_FIPS_ENDPOINT=true)")
+	fs.Func("retry-mode", "`mode` of retrying failed AWS API calls: standard (default), or adaptive,"+
+		" which also limits the rate of calls when throttled", func(s string) error {
+		mode, err := aws.ParseRetryMode(s)
+		awsFlags.retryMode = mode
+		return err
+	})
+	fs.IntVar(&awsFlags.maxAttempts, "max-attempts", 0, "maximum `number` of attempts of each AWS API call (default 3)")
+	fs.DurationVar(&awsFlags.maxBackoff, "max-backoff", 0, "maximum `delay` between attempts of AWS API calls (default 20s)")
+	fs.BoolVar(&awsFlags.dualStack, "dualstack", false, "use dual-stack endpoints of AWS services, reachable over IPv6 (also AWS_USE_DUALSTACK_ENDPOINT=true)")
+}
+
+// loadAWSConfig loads the shared AWS configuration, applying awsFlags, with
+// SDK logging set up according to verbosity
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	if awsFlags.roleArn == "" && (awsFlags.externalID != "" || awsFlags.mfaSerial != "") {
+		return aws.Config{}, withExitCode(exitInvalid, errors.New("-external-id and -mfa-serial flags require -role-arn"))
+	}
+	var opts []func(*config.LoadOptions) error
+	if awsFlags.profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(awsFlags.profile))
+	}
+	if awsFlags.region != "" {
+		opts = append(opts, config.WithRegion(awsFlags.region))
+	}
+	if awsFlags.endpointURL != "" {
+		opts = append(opts, config.WithBaseEndpoint(awsFlags.endpointURL))
+	}
+	if awsFlags.fips {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if awsFlags.dualStack {
+		opts = append(opts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+	if awsFlags.retryMode != "" || awsFlags.maxAttempts > 0 || awsFlags.maxBackoff > 0 {
+		opts = append(opts, config.WithRetryer(newRetryer))
+	}
+	if awsFlags.credCommand != "" {
+		opts = append(opts, config.WithCredentialsProvider(processcreds.NewProvider(awsFlags.credCommand)))
+	}
+	if verbosity > 0 {
+		mode := aws.LogRetries
+		if verbosity > 1 {
+			mode |= aws.LogRequest | aws.LogResponse | aws.LogSigning
+		}
+		opts = append(opts, config.WithClientLogMode(mode), config.WithLogger(sdkLogger{}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, err
+	}
+	if awsFlags.credCommand == "" {
+		if err := checkSSOSession(ctx, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if awsFlags.roleArn == "" {
+		return cfg, nil
+	}
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), awsFlags.roleArn,
+		func(o *stscreds.AssumeRoleOptions) {
+			// longer than the default 15 minutes, so that MFA token is not
+			// asked too often in -watch mode
+			o.Duration = time.Hour
+			if awsFlags.externalID != "" {
+				o.ExternalID = &awsFlags.externalID
+			}
+			if awsFlags.mfaSerial != "" {
+				o.SerialNumber = &awsFlags.mfaSerial
+				o.TokenProvider = promptMFAToken
+			}
+		}))
+	return cfg, nil
+}
+
+// newRetryer returns retryer of awsFlags.retryMode with the limits set by
+// awsFlags
+func newRetryer() aws.Retryer {
+	limits := func(o *retry.StandardOptions) {
+		if awsFlags.maxAttempts > 0 {
+			o.MaxAttempts = awsFlags.maxAttempts
+		}
+		if awsFlags.maxBackoff > 0 {
+			o.MaxBackoff = awsFlags.maxBackoff
+		}
+	}
+	if awsFlags.retryMode == aws.RetryModeAdaptive {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, limits)
+		})
+	}
+	return retry.NewStandard(limits)
+}
+
+// promptMFAToken asks for the MFA token code on stderr and reads it from
+// stdin. Unlike stscreds.StdinTokenProvider, it keeps stdout clean for -json
+// output.
+func promptMFAToken() (string, error) {
+	fmt.Fprintf(os.Stderr, "MFA token code for %s: ", awsFlags.mfaSerial)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if line = strings.TrimSpace(line); line == "" {
+		if err == nil {
+			err = errors.New("empty input")
+		}
+		return "", fmt.Errorf("reading MFA token code: %w", err)
+	}
+	return line, nil
+}
+
+// newS3Client returns S3 client; if custom endpoint is configured, it uses
+// path-style addressing, as LocalStack and other S3 emulators expect
+func newS3Client(cfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = cfg.BaseEndpoint != nil
+	})
+}
+
+// sdkLogger passes AWS SDK log messages to slog at debug level, redacting
+// credentials from the dumped HTTP requests
+type sdkLogger struct{}
+
+func (sdkLogger) Logf(classification logging.Classification, format string, v ...any) {
+	msg := secretHeaders.ReplaceAllString(fmt.Sprintf(format, v...), "${1}[redacted]")
+	slog.Debug(msg, "source", "aws-sdk", "classification", string(classification))
+}
+
+// secretHeaders matches values of the HTTP headers carrying credentials, both
+// in the dumped requests and in the canonical requests logged when signing
+var secretHeaders = regexp.MustCompile(`(?im)^((?:Authorization|X-Amz-Security-Token):[ \t]*)[^\r\n]*`)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/gosym"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// packageSizes returns the size of the machine code of the binary by Go
+// package. Binaries are built without the symbol table, so sizes come from
+// the function table the runtime needs, which only covers the code, not the
+// data: the latter is reported as the sizes of the other ELF sections.
+func packageSizes(binPath string) (map[string]int64, error) {
+	f, err := elf.Open(binPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	text, pclntab := f.Section(".text"), f.Section(".gopclntab")
+	if text == nil || pclntab == nil {
+		return nil, errors.New("binary has no Go function table")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("reading Go function table: %w", err)
+	}
+	sizes := make(map[string]int64)
+	for _, fn := range table.Funcs {
+		pkg := fn.PackageName()
+		if pkg == "" {
+			pkg = "(other)"
+		}
+		sizes[pkg] += int64(fn.End - fn.Entry)
+	}
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOBITS && s.Flags&elf.SHF_ALLOC != 0 && s.Name != ".text" {
+			sizes["section "+s.Name] += int64(s.Size)
+		}
+	}
+	return sizes, nil
+}
+
+// sizeReport writes the top contributors to the binary size to w, along with
+// the change of each since the previous report of the binary built from the
+// same package with the same key, which is kept in the user cache directory
+func sizeReport(w io.Writer, binPath, dir, key string) error {
+	sizes, err := packageSizes(binPath)
+	if err != nil {
+		return fmt.Errorf("-why-big: %w", err)
+	}
+	var prev map[string]int64
+	cacheFile := ""
+	if cache, err := os.UserCacheDir(); err == nil {
+		abs, _ := filepath.Abs(dir)
+		sum := sha256.Sum256([]byte(abs + "\x00" + key))
+		cacheFile = filepath.Join(cache, "publish-go-lambda", "size-"+hex.EncodeToString(sum[:8])+".json")
+		if b, err := os.ReadFile(cacheFile); err == nil {
+			json.Unmarshal(b, &prev)
+		}
+	}
+	var total int64
+	for _, n := range sizes {
+		total += n
+	}
+	names := slices.SortedFunc(maps.Keys(sizes), func(a, b string) int {
+		return cmp.Or(cmp.Compare(sizes[b], sizes[a]), cmp.Compare(a, b))
+	})
+	fi, err := os.Stat(binPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Binary %s (%s), %s of code and data:\n", strings.TrimSuffix(key, ":"), sizeString(fi.Size()),
+		sizeString(total))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "SIZE\tSHARE\tDELTA\t\tPACKAGE")
+	delta := func(name string) string {
+		if prev == nil {
+			return "-"
+		}
+		d, ok := sizes[name]-prev[name], prev[name] != 0
+		switch {
+		case !ok:
+			return "new"
+		case d == 0:
+			return "0"
+		}
+		return fmt.Sprintf("%+d", d)
+	}
+	for _, name := range names[:min(len(names), 25)] {
+		fmt.Fprintf(tw, "%d\t%.1f%%\t%s\t\t%s\n", sizes[name], 100*float64(sizes[name])/float64(total), delta(name), name)
+	}
+	// packages no longer in the binary tell what the change replaced
+	if prev != nil {
+		var gone []string
+		for name := range prev {
+			if _, ok := sizes[name]; !ok {
+				gone = append(gone, name)
+			}
+		}
+		slices.Sort(gone)
+		for _, name := range gone {
+			fmt.Fprintf(tw, "0\t0.0%%\t%+d\t\t%s\n", -prev[name], name)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if cacheFile != "" {
+		b, _ := json.Marshal(sizes)
+		err := os.MkdirAll(filepath.Dir(cacheFile), 0700)
+		if err == nil {
+			err = os.WriteFile(cacheFile, b, 0600)
+		}
+		if err != nil {
+			slog.Debug("saving size report", "err", err)
+		}
+	}
+	return nil
+}
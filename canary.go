@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// canary shifts args.canaryWeight percent of alias traffic to the version,
+// watches its metrics for args.bakeTime, then points alias to the version if
+// metrics are within the limits, or restores the alias routing otherwise.
+func (t *target) canary(ctx context.Context, args *runArgs, version string) error {
+	alias, err := t.svc.GetAlias(ctx, &lambda.GetAliasInput{FunctionName: &t.name, Name: &args.alias})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if !errors.As(err, &notFound) {
+			return fmt.Errorf("GetAlias: %w", err)
+		}
+		t.logf("alias %s does not exist yet, creating it without canary", args.alias)
+		return t.pointAlias(ctx, args.alias, version)
+	}
+	stable := aws.ToString(alias.FunctionVersion)
+	setRouting := func(ctx context.Context, weights map[string]float64) error {
+		_, err := t.svc.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+			FunctionName:    &t.name,
+			Name:            &args.alias,
+			FunctionVersion: &stable,
+			RoutingConfig:   &types.AliasRoutingConfiguration{AdditionalVersionWeights: weights},
+		})
+		return err
+	}
+	start := time.Now()
+	if err := setRouting(ctx, map[string]float64{version: args.canaryWeight / 100}); err != nil {
+		return fmt.Errorf("setting alias routing: %w", err)
+	}
+	t.logf("routing %g%% of alias %s traffic to version %s (the rest goes to version %s) for %v",
+		args.canaryWeight, args.alias, version, stable, args.bakeTime)
+	rollback := func(reason error) error {
+		// parent context may be already canceled, but routing still must be restored
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := setRouting(ctx, map[string]float64{}); err != nil {
+			return fmt.Errorf("canary failed (%w), and restoring alias routing failed too: %w", reason, err)
+		}
+		t.logf("alias %s routing restored, all traffic goes to version %s", args.alias, stable)
+		return fmt.Errorf("canary failed: %w", reason)
+	}
+	cw := cloudwatch.NewFromConfig(t.awsCfg)
+	// check every minute, the metrics period, or more often for shorter bake
+	// times, and stop as soon as the bake time is over
+	ticker := time.NewTicker(min(time.Minute, args.bakeTime))
+	defer ticker.Stop()
+	baked := time.NewTimer(args.bakeTime - time.Since(start))
+	defer baked.Stop()
+bake:
+	for {
+		select {
+		case <-ctx.Done():
+			return rollback(ctx.Err())
+		case <-baked.C:
+			break bake
+		case <-ticker.C:
+		}
+		if err := t.checkCanary(ctx, cw, args, version, start); err != nil {
+			return rollback(err)
+		}
+	}
+	// metrics are delayed, give them a final check
+	if err := t.checkCanary(ctx, cw, args, version, start); err != nil {
+		return rollback(err)
+	}
+	_, err = t.svc.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    &t.name,
+		Name:            &args.alias,
+		FunctionVersion: &version,
+		RoutingConfig:   &types.AliasRoutingConfiguration{AdditionalVersionWeights: map[string]float64{}},
+	})
+	if err != nil {
+		return rollback(fmt.Errorf("promoting version: %w", err))
+	}
+	t.logf("canary succeeded, alias %s now points to version %s", args.alias, version)
+	return nil
+}
+
+// checkCanary returns an error if the metrics of the version executed via
+// alias since the start time exceed the limits set in args
+func (t *target) checkCanary(ctx context.Context, cw *cloudwatch.Client, args *runArgs, version string, start time.Time) error {
+	fnName := aws.ToString(t.cfg.FunctionName)
+	dims := []cwtypes.Dimension{
+		{Name: aws.String("FunctionName"), Value: &fnName},
+		{Name: aws.String("Resource"), Value: aws.String(fnName + ":" + args.alias)},
+		{Name: aws.String("ExecutedVersion"), Value: &version},
+	}
+	query := func(id, metric, stat string) cwtypes.MetricDataQuery {
+		return cwtypes.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &cwtypes.MetricStat{
+				Metric: &cwtypes.Metric{Namespace: aws.String("AWS/Lambda"), MetricName: &metric, Dimensions: dims},
+				Period: aws.Int32(60),
+				Stat:   &stat,
+			},
+		}
+	}
+	out, err := cw.GetMetricData(ctx, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(start.Add(-time.Minute).Truncate(time.Minute)),
+		EndTime:   aws.Time(time.Now()),
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			query("errors", "Errors", "Sum"),
+			query("invocations", "Invocations", "Sum"),
+			query("duration", "Duration", "Average"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("GetMetricData: %w", err)
+	}
+	var errCount, invocations, maxDuration float64
+	for _, r := range out.MetricDataResults {
+		for _, v := range r.Values {
+			switch aws.ToString(r.Id) {
+			case "errors":
+				errCount += v
+			case "invocations":
+				invocations += v
+			case "duration":
+				maxDuration = max(maxDuration, v)
+			}
+		}
+	}
+	t.logf("canary: %g invocations, %g errors, %.1fms max average duration", invocations, errCount, maxDuration)
+	if errCount > float64(args.canaryMaxErrors) {
+		return fmt.Errorf("version %s reported %g errors, more than allowed %d", version, errCount, args.canaryMaxErrors)
+	}
+	if d := time.Duration(maxDuration * float64(time.Millisecond)); args.canaryMaxDuration > 0 && d > args.canaryMaxDuration {
+		return fmt.Errorf("version %s average duration %v is above the limit %v", version, d, args.canaryMaxDuration)
+	}
+	return nil
+}
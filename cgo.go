@@ -0,0 +1,113 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// cgoGlibc is the glibc version cgo binaries are built against with zig:
+// the one of Amazon Linux 2, so that binaries run on all Lambda runtimes
+const cgoGlibc = "2.26"
+
+// zigCompilers returns CC and CXX values to cross-compile cgo code for
+// linux and the given Go arch with zig
+func zigCompilers(arch string) (cc, cxx string, err error) {
+	if _, err := exec.LookPath("zig"); err != nil {
+		return "", "", errors.New("-cgo requires zig to cross-compile C code, install it, set -cc, or use -build-in-docker")
+	}
+	target := "x86_64-linux-gnu." + cgoGlibc
+	if arch == goArm64 {
+		target = "aarch64-linux-gnu." + cgoGlibc
+	}
+	return "zig cc -target " + target, "zig c++ -target " + target, nil
+}
+
+// runtimeGlibc returns glibc version of the Lambda runtime
+func runtimeGlibc(runtime types.Runtime) string {
+	if runtime == types.RuntimeProvidedal2023 || runtime == "" {
+		// empty runtime is for container images, default base image
+		// is based on Amazon Linux 2023
+		return "2.34"
+	}
+	return cgoGlibc
+}
+
+// systemLibraries are shared libraries available on all Amazon Linux
+// versions Lambda runtimes are based on
+var systemLibraries = map[string]bool{
+	"libc.so.6":             true,
+	"libm.so.6":             true,
+	"libdl.so.2":            true,
+	"librt.so.1":            true,
+	"libpthread.so.0":       true,
+	"libresolv.so.2":        true,
+	"libgcc_s.so.1":         true,
+	"libstdc++.so.6":        true,
+	"ld-linux-x86-64.so.2":  true,
+	"ld-linux-aarch64.so.1": true,
+}
+
+// checkGlibc verifies that dynamically linked binary only needs system
+// libraries, and the glibc version it requires is not newer than maxGlibc
+func checkGlibc(path, maxGlibc string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, lib := range libs {
+		if !systemLibraries[lib] {
+			return fmt.Errorf("%s needs shared library %s, which is not available on Lambda, link it statically", path, lib)
+		}
+	}
+	syms, err := f.ImportedSymbols()
+	if errors.Is(err, elf.ErrNoSymbols) {
+		return nil // statically linked
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, sym := range syms {
+		v, ok := strings.CutPrefix(sym.Version, "GLIBC_")
+		if !ok {
+			continue
+		}
+		if compareVersions(v, maxGlibc) > 0 {
+			return fmt.Errorf("%s needs glibc %s (for %s), but the Lambda runtime only has glibc %s",
+				path, v, sym.Name, maxGlibc)
+		}
+	}
+	return nil
+}
+
+// compareVersions compares dot-separated numeric versions, returning -1, 0,
+// or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
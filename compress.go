@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// deflateChunkSize is the size of the input chunks parallelWriter
+// compresses independently
+const deflateChunkSize = 1 << 20
+
+// deflateWindow is the DEFLATE window size, the distance back-references can
+// reach
+const deflateWindow = 32 << 10
+
+// parallelWriter is a DEFLATE compressor that splits the input into chunks
+// compressed concurrently, the way pigz does it: each chunk is compressed
+// with the end of the previous one as a dictionary, and ends on a byte
+// boundary with a sync flush, so that the concatenated chunks are a single
+// valid DEFLATE stream any decompressor reads. Output only depends on the
+// input and the level, not on the number of CPUs, and input that fits into
+// a single chunk is compressed exactly as with flate.Writer.
+type parallelWriter struct {
+	w     io.Writer
+	level int
+	buf   []byte // input of the chunk being filled
+	dict  []byte // end of the previous chunk input
+	queue chan *deflateChunk
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error // first error, set by drain
+}
+
+// deflateChunk is the chunk being compressed, out is only safe to read once
+// ready is closed
+type deflateChunk struct {
+	out   bytes.Buffer
+	err   error
+	ready chan struct{}
+}
+
+func newParallelWriter(w io.Writer, level int) (*parallelWriter, error) {
+	// check the level upfront, so that chunks do not fail on it
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	pw := &parallelWriter{
+		w:     w,
+		level: level,
+		queue: make(chan *deflateChunk, runtime.GOMAXPROCS(0)),
+		done:  make(chan struct{}),
+	}
+	go pw.drain()
+	return pw, nil
+}
+
+// drain writes compressed chunks to w in order, as they become ready. Once
+// either compression or the write fails, it only waits for the rest of the
+// chunks.
+func (pw *parallelWriter) drain() {
+	defer close(pw.done)
+	var err error
+	for c := range pw.queue {
+		<-c.ready
+		if err != nil {
+			continue
+		}
+		if err = c.err; err == nil {
+			_, err = pw.w.Write(c.out.Bytes())
+		}
+		if err != nil {
+			pw.mu.Lock()
+			pw.err = err
+			pw.mu.Unlock()
+		}
+	}
+}
+
+// error returns the first error of compression or the write to w
+func (pw *parallelWriter) error() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+// Write buffers p, starting compression of each full chunk. It fails once
+// compression or the write of the compressed chunks fails, so that the rest
+// of the input is not compressed for nothing.
+func (pw *parallelWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) != 0 {
+		if err := pw.error(); err != nil {
+			return n - len(p), err
+		}
+		if pw.buf == nil {
+			pw.buf = make([]byte, 0, deflateChunkSize)
+		}
+		k := min(len(p), deflateChunkSize-len(pw.buf))
+		pw.buf, p = append(pw.buf, p[:k]...), p[k:]
+		if len(pw.buf) == deflateChunkSize {
+			pw.flushChunk(false)
+		}
+	}
+	return n, nil
+}
+
+// flushChunk starts compression of the buffered input, which is the end of
+// the stream if final is set. It blocks while as many chunks as there are
+// CPUs are already waiting to be written.
+func (pw *parallelWriter) flushChunk(final bool) {
+	c := &deflateChunk{ready: make(chan struct{})}
+	pw.queue <- c
+	go func(in, dict []byte) {
+		defer close(c.ready)
+		fw, err := flate.NewWriterDict(&c.out, pw.level, dict)
+		if err != nil {
+			c.err = err
+			return
+		}
+		if _, err := fw.Write(in); err != nil {
+			c.err = err
+			return
+		}
+		if final {
+			c.err = fw.Close()
+		} else {
+			c.err = fw.Flush()
+		}
+	}(pw.buf, pw.dict)
+	pw.dict = pw.buf[max(0, len(pw.buf)-deflateWindow):]
+	pw.buf = nil
+}
+
+// Close compresses the rest of the input, and waits for all of it to be
+// written. It does not close the underlying writer.
+func (pw *parallelWriter) Close() error {
+	if pw.error() == nil {
+		pw.flushChunk(true)
+	}
+	close(pw.queue)
+	<-pw.done
+	return pw.error()
+}
+
+// compression is the -compression flag value, the way to compress packaged
+// files
+type compression string
+
+const (
+	compressionFast  compression = "fast"  // fastest DEFLATE level
+	compressionBest  compression = "best"  // best DEFLATE level, slowest
+	compressionStore compression = "store" // no compression
+	compressionAuto  compression = "auto"  // chosen by compressing samples of each file
+)
+
+func parseCompression(s string) (compression, error) {
+	switch c := compression(s); c {
+	case compressionFast, compressionBest, compressionStore, compressionAuto:
+		return c, nil
+	}
+	return "", fmt.Errorf("unsupported compression %q, want one of %s, %s, %s, or %s", s,
+		compressionFast, compressionBest, compressionStore, compressionAuto)
+}
+
+// compressionSampleSize is the size of each of the three samples, from the
+// start, middle, and end of the file, that auto compression compresses to
+// choose how to compress the file
+const compressionSampleSize = 256 << 10
+
+// compressionTolerance is how much bigger than with the best compression
+// the samples may get with the faster one auto compression chooses
+const compressionTolerance = 0.03
+
+// method returns zip method and DEFLATE level to compress the file at path
+// with. For auto compression, it also returns the description of the
+// choice, which is made from the file samples: the fastest of no
+// compression, the fast, default, and best DEFLATE levels, that gets the
+// samples within compressionTolerance of the best level. Choice only depends
+// on the file content, so packaging stays reproducible.
+func (c compression) method(path string) (method uint16, level int, desc string, err error) {
+	switch c {
+	case compressionFast:
+		return zip.Deflate, flate.BestSpeed, "", nil
+	case compressionStore:
+		return zip.Store, 0, "", nil
+	case compressionAuto:
+	default:
+		return zip.Deflate, flate.BestCompression, "", nil
+	}
+	sample, err := fileSample(path)
+	if err != nil || len(sample) == 0 {
+		return zip.Store, 0, "", err
+	}
+	// level 6 is the one flate.DefaultCompression stands for
+	levels := []int{flate.NoCompression, flate.BestSpeed, 6, flate.BestCompression}
+	sizes := make([]int64, len(levels))
+	for i, l := range levels {
+		cw := &countingWriter{w: io.Discard}
+		fw, err := flate.NewWriter(cw, l)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		if _, err := fw.Write(sample); err != nil {
+			return 0, 0, "", err
+		}
+		if err := fw.Close(); err != nil {
+			return 0, 0, "", err
+		}
+		sizes[i] = cw.n
+	}
+	best := sizes[len(sizes)-1]
+	i := slices.IndexFunc(sizes, func(n int64) bool { return float64(n) <= (1+compressionTolerance)*float64(best) })
+	ratio := func(n int64) string {
+		return strconv.FormatFloat(100*float64(n)/float64(len(sample)), 'f', 1, 64) + "%"
+	}
+	if levels[i] == flate.NoCompression {
+		return zip.Store, 0, "stored, best compression only gets samples to " + ratio(best), nil
+	}
+	return zip.Deflate, levels[i], fmt.Sprintf("DEFLATE level %d, samples get to %s of the size, %s with the best level",
+		levels[i], ratio(sizes[i]), ratio(best)), nil
+}
+
+// fileSample returns the file content if it is small, or its samples from
+// the start, middle, and end otherwise
+func fileSample(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() <= 3*compressionSampleSize {
+		return io.ReadAll(f)
+	}
+	b := make([]byte, 3*compressionSampleSize)
+	for i, off := range []int64{0, fi.Size()/2 - compressionSampleSize/2, fi.Size() - compressionSampleSize} {
+		if _, err := f.ReadAt(b[i*compressionSampleSize:(i+1)*compressionSampleSize], off); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
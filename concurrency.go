@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+// setConcurrency sets reserved concurrency of the function to n, or removes
+// the reservation if n is 0. If the setting changes, the previous one is
+// remembered for restoreConcurrency.
+func (t *target) setConcurrency(ctx context.Context, n int32) error {
+	out, err := t.svc.GetFunctionConcurrency(ctx, &lambda.GetFunctionConcurrencyInput{FunctionName: &t.name})
+	if err != nil {
+		return fmt.Errorf("GetFunctionConcurrency: %w", err)
+	}
+	prev, want := out.ReservedConcurrentExecutions, reservation(n)
+	if aws.ToInt32(prev) == n && (prev != nil) == (want != nil) {
+		return nil
+	}
+	if err := t.putConcurrency(ctx, want); err != nil {
+		return err
+	}
+	t.logf("reserved concurrency changed from %s to %s", concurrencyString(prev), concurrencyString(want))
+	t.prevConcurrency, t.concurrencyChanged = prev, true
+	return nil
+}
+
+// restoreConcurrency restores reserved concurrency the function had before
+// setConcurrency changed it, including the reservation of 0 that throttles
+// the function
+func (t *target) restoreConcurrency(ctx context.Context) error {
+	if !t.concurrencyChanged {
+		return nil
+	}
+	if err := t.putConcurrency(ctx, t.prevConcurrency); err != nil {
+		return err
+	}
+	t.logf("reserved concurrency restored to %s", concurrencyString(t.prevConcurrency))
+	t.concurrencyChanged = false
+	return nil
+}
+
+// putConcurrency reserves n concurrent executions for the function, or
+// removes the reservation if n is nil
+func (t *target) putConcurrency(ctx context.Context, n *int32) error {
+	if n == nil {
+		if _, err := t.svc.DeleteFunctionConcurrency(ctx, &lambda.DeleteFunctionConcurrencyInput{FunctionName: &t.name}); err != nil {
+			return fmt.Errorf("DeleteFunctionConcurrency: %w", err)
+		}
+		return nil
+	}
+	if _, err := t.svc.PutFunctionConcurrency(ctx, &lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 &t.name,
+		ReservedConcurrentExecutions: n,
+	}); err != nil {
+		return fmt.Errorf("PutFunctionConcurrency: %w", err)
+	}
+	return nil
+}
+
+// reservation returns the reserved concurrency to set for the
+// -reserved-concurrency value n, nil for no reservation if n is 0
+func reservation(n int32) *int32 {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// concurrencyString describes reserved concurrency setting for logs
+func concurrencyString(n *int32) string {
+	if n == nil {
+		return "none"
+	}
+	return fmt.Sprint(*n)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// configFile describes a set of functions published together, it is usually
+// kept at the repository root.
+//
+//	{"functions": [
+//		{"dir": "cmd/my-function"},
+//		{"dir": "cmd/other", "name": "other-function", "tags": ["prod"]}
+//	]}
+//
+// Relative directories are resolved against the directory of the config file.
+//
+// Optional "roles" list holds IAM role ARNs to assume, publishing functions to
+// each role's account; it is used when -roles flag is not set.
+type configFile struct {
+	Functions []functionConfig `json:"functions"`
+	Roles     []string         `json:"roles"`
+}
+
+type functionConfig struct {
+	Dir  string   `json:"dir"`  // directory with the main package
+	Name string   `json:"name"` // Lambda name or ARN, defaults to the last element of Dir
+	Tags []string `json:"tags"` // build tags
+
+	// Build is a shell command to build the binary with, in the same form
+	// as -build-cmd flag
+	Build string `json:"build"`
+
+	Generate bool `json:"generate"` // run go generate before building
+
+	// Include lists extra files and directories to package, in the same
+	// form as -include flag; relative paths are resolved against the
+	// directory of the config file
+	Include []string `json:"include"`
+
+	// Helpers lists extra main packages to build and package, in the same
+	// form as -helper flag
+	Helpers []string `json:"helpers"`
+
+	// Extensions lists main packages to build as Lambda extensions, in the
+	// same form as -extension flag
+	Extensions []string `json:"extensions"`
+
+	// Env holds environment variables the function is expected to have,
+	// in the same way as -env-check flag
+	Env map[string]string `json:"env"`
+}
+
+func loadConfig(name string) (*configFile, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(configFile)
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	base := filepath.Dir(name)
+	seen := make(map[string]struct{})
+	for i := range cfg.Functions {
+		fn := &cfg.Functions[i]
+		if fn.Dir == "" {
+			return nil, fmt.Errorf("%s: function #%d has an empty dir", name, i+1)
+		}
+		if !filepath.IsAbs(fn.Dir) {
+			fn.Dir = filepath.Join(base, fn.Dir)
+		}
+		if fn.Name == "" {
+			fn.Name = filepath.Base(fn.Dir)
+		}
+		for _, list := range [][]string{fn.Include, fn.Helpers, fn.Extensions} {
+			for j, s := range list {
+				if !filepath.IsAbs(s) {
+					list[j] = filepath.Join(base, s)
+				}
+			}
+		}
+		if _, ok := seen[fn.Name]; ok {
+			return nil, fmt.Errorf("%s: function %q listed more than once", name, fn.Name)
+		}
+		seen[fn.Name] = struct{}{}
+	}
+	return cfg, nil
+}
+
+// runConfig publishes functions from the args.configFile. If names are given,
+// only functions with these names are published.
+func runConfig(ctx context.Context, args runArgs, names []string) error {
+	cfg, err := loadConfig(args.configFile)
+	if err != nil {
+		return err
+	}
+	fns, err := cfg.selectFunctions(names)
+	if err != nil {
+		return err
+	}
+	if len(args.roles) == 0 {
+		args.roles = cfg.Roles
+	}
+	args.codeStorage = make(codeStorage)
+	var unchanged int
+	for _, fn := range fns {
+		a := args
+		a.name, a.dir = fn.Name, fn.Dir
+		a.generate = a.generate || fn.Generate
+		if fn.Build != "" {
+			a.buildCmd = fn.Build
+		}
+		a.tags = append(a.tags[:len(a.tags):len(a.tags)], fn.Tags...)
+		a.includes = append(a.includes[:len(a.includes):len(a.includes)], fn.Include...)
+		a.helpers = append(a.helpers[:len(a.helpers):len(a.helpers)], fn.Helpers...)
+		a.extensions = append(a.extensions[:len(a.extensions):len(a.extensions)], fn.Extensions...)
+		if fn.Env != nil {
+			a.envCheck = fn.Env
+		}
+		slog.Info(fmt.Sprintf("publishing %s from %s", fn.Name, fn.Dir))
+		if err := run(ctx, a); errors.Is(err, errNothingToDeploy) {
+			unchanged++
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", fn.Name, err)
+		}
+	}
+	if unchanged == len(fns) {
+		return errNothingToDeploy
+	}
+	return nil
+}
+
+// selectFunctions returns configured functions with given names, or all
+// functions if names is empty
+func (cfg *configFile) selectFunctions(names []string) ([]functionConfig, error) {
+	if len(cfg.Functions) == 0 {
+		return nil, errors.New("config has no functions")
+	}
+	if len(names) == 0 {
+		return cfg.Functions, nil
+	}
+	var out []functionConfig
+outer:
+	for _, name := range names {
+		for _, fn := range cfg.Functions {
+			if fn.Name == name {
+				out = append(out, fn)
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("function %q not found in config", name)
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const cosignBundleSuffix = ".zip.sigstore.json"
+
+// cosignPackage signs the package with cosign sign-blob, either with the key,
+// which is anything cosign accepts as --key, like a key file or a KMS URI,
+// or, if key is empty, keyless, with the OIDC identity cosign finds, like the
+// one of the GitHub Actions workflow. It returns the Sigstore bundle with the
+// signature, to verify the package with cosign verify-blob.
+func (t *target) cosignPackage(ctx context.Context, key string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "publish-go-lambda-cosign-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "bundle.json")
+	cmdArgs := []string{"sign-blob", "--yes", "--bundle", bundle}
+	if key != "" {
+		cmdArgs = append(cmdArgs, "--key", key)
+	}
+	t.logf("signing package with cosign")
+	cmd := exec.CommandContext(ctx, "cosign", append(cmdArgs, t.pkg.path)...)
+	// cosign asks for the key password, or opens the browser for the
+	// keyless sign-in, unless the environment provides them
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running cosign: %w", err)
+	}
+	return os.ReadFile(bundle)
+}
+
+// writeCosignBundle stores the package and its cosign bundle next to each
+// other, as version.zip and version.zip.sigstore.json objects
+func (t *target) writeCosignBundle(ctx context.Context, s *versionStore) error {
+	if t.cosignBundle == nil {
+		return nil
+	}
+	rec, err := t.deployRecord(ctx)
+	if err != nil {
+		return err
+	}
+	pkg, err := os.Open(t.pkg.path)
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+	client := newS3Client(s.cfg)
+	for suffix, body := range map[string]io.Reader{".zip": pkg, cosignBundleSuffix: bytes.NewReader(t.cosignBundle)} {
+		key := s.key(rec.Function, t.version, suffix)
+		if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: &s.bucket,
+			Key:    &key,
+			Body:   body,
+		}); err != nil {
+			return fmt.Errorf("S3 PutObject: %w", err)
+		}
+		t.debugf("wrote s3://%s/%s", s.bucket, key)
+	}
+	return nil
+}
+
+// checkCosign makes sure cosign is installed before the build, so that the
+// deploy does not fail after it
+func checkCosign() error {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("-cosign requires cosign to be installed: %w", err)
+	}
+	return nil
+}
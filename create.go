@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// create creates a new function with the target code, returning the number
+// of the published version. New function uses the latest custom runtime for
+// Go. Once function is created, its configuration is saved to t.cfg.
+func (t *target) create(ctx context.Context, args *runArgs) (string, error) {
+	in := &lambda.CreateFunctionInput{
+		FunctionName:  &t.name,
+		Role:          &args.role,
+		Runtime:       types.RuntimeProvidedal2023,
+		Handler:       aws.String("bootstrap"),
+		Architectures: []types.Architecture{lambdaArch(t.arch)},
+		PackageType:   types.PackageTypeZip,
+		Publish:       t.description == "" && args.runtimeUpdate == nil,
+	}
+	if len(args.env) != 0 {
+		in.Environment = &types.Environment{Variables: args.env}
+	}
+	if args.memory != 0 {
+		in.MemorySize = &args.memory
+	}
+	if args.functionTimeout != 0 {
+		in.Timeout = aws.Int32(int32(args.functionTimeout / time.Second))
+	}
+	if args.ephemeralStorage != 0 {
+		in.EphemeralStorage = &types.EphemeralStorage{Size: &args.ephemeralStorage}
+	}
+	if args.tracing != "" {
+		in.TracingConfig = &types.TracingConfig{Mode: args.tracing}
+	}
+	ctx, cancel := context.WithTimeout(ctx, args.timeout)
+	defer cancel()
+	if len(t.extensions) != 0 {
+		layer, err := t.publishExtensions(ctx, args, in.Architectures)
+		if err != nil {
+			return "", fmt.Errorf("publishing extensions: %w", err)
+		}
+		in.Layers = []string{aws.ToString(layer.LayerVersionArn)}
+	}
+	if args.insights {
+		layer, err := insightsLayer(t.awsCfg.Region, t.arch)
+		if err == nil {
+			layer, err = latestLayerVersion(ctx, t.svc, layer, 0)
+		}
+		if err == nil {
+			err = t.ensureRolePolicy(ctx, args, args.role, insightsPolicy)
+		}
+		if err != nil {
+			return "", fmt.Errorf("enabling Lambda Insights: %w", err)
+		}
+		in.Layers = append(in.Layers, layer)
+	}
+	if args.adot != "" {
+		layer, err := latestLayerVersion(ctx, t.svc, adotLayer(t.awsCfg.Region, t.arch, args.adot), 0)
+		if err != nil {
+			return "", fmt.Errorf("enabling ADOT collector: %w", err)
+		}
+		in.Layers = append(in.Layers, layer)
+		// same as enableADOT does for the existing functions
+		if _, ok := args.env["OTEL_SERVICE_NAME"]; !ok {
+			vars := maps.Clone(args.env)
+			if vars == nil {
+				vars = make(map[string]string)
+			}
+			vars["OTEL_SERVICE_NAME"] = t.name
+			in.Environment = &types.Environment{Variables: vars}
+		}
+		if args.tracing == "" {
+			in.TracingConfig = &types.TracingConfig{Mode: types.TracingModeActive}
+		}
+	}
+	var err error
+	if in.Code, err = t.code(ctx, args); err != nil {
+		return "", err
+	}
+	out, err := t.svc.CreateFunction(ctx, in)
+	if err != nil {
+		return "", fmt.Errorf("CreateFunction: %w", err)
+	}
+	w := lambda.NewFunctionActiveV2Waiter(t.svc)
+	if err := w.Wait(ctx, &lambda.GetFunctionInput{FunctionName: &t.name}, maxWait(ctx)); err != nil {
+		return "", fmt.Errorf("waiting for the new function to become active: %w", err)
+	}
+	if t.cfg, err = t.svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &t.name,
+		Qualifier:    aws.String("$LATEST"),
+	}); err != nil {
+		return "", fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	if args.runtimeUpdate != nil {
+		if err := t.syncRuntimeUpdate(ctx, args); err != nil {
+			return "", fmt.Errorf("updating runtime management configuration: %w", err)
+		}
+	}
+	if !in.Publish {
+		// publish separately to set version description, or to publish the
+		// version with the runtime management configuration set
+		return t.publishVersion(ctx, t.cfg.CodeSha256, t.cfg.RevisionId)
+	}
+	return aws.ToString(out.Version), nil
+}
+
+// lambdaArch converts Go arch to Lambda architecture
+func lambdaArch(goArch string) types.Architecture {
+	if goArch == goAmd64 {
+		return types.ArchitectureX8664
+	}
+	return types.ArchitectureArm64
+}
+
+// parseArch parses either Lambda architecture or Go arch name, returning Go
+// arch
+func parseArch(s string) (string, error) {
+	switch s {
+	case string(types.ArchitectureArm64):
+		return goArm64, nil
+	case string(types.ArchitectureX8664), goAmd64:
+		return goAmd64, nil
+	}
+	return "", fmt.Errorf("unsupported architecture %q, want either %s or %s",
+		s, types.ArchitectureArm64, types.ArchitectureX8664)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// deployInfo describes what is being deployed
+type deployInfo struct {
+	commit  string // git commit SHA, empty if not in a git repository
+	branch  string // git branch, empty if HEAD is detached
+	subject string // first line of the commit message
+	dirty   bool   // working tree has uncommitted changes
+	remote  string // URL of the origin remote, without credentials
+	start   time.Time
+}
+
+// newDeployInfo collects git details of the repository dir belongs to
+func newDeployInfo(ctx context.Context, dir string) *deployInfo {
+	info := &deployInfo{start: time.Now()}
+	git := func(args ...string) string {
+		out, _ := gitOutput(ctx, dir, args...)
+		return out
+	}
+	if info.commit = git("rev-parse", "HEAD"); info.commit == "" {
+		return info
+	}
+	info.branch = git("symbolic-ref", "--short", "-q", "HEAD")
+	info.subject = git("log", "-1", "--format=%s")
+	info.dirty = git("status", "--porcelain") != ""
+	info.remote = originURL(git("remote", "get-url", "origin"))
+	return info
+}
+
+// versionDescription returns description for the published version: short
+// commit SHA with the first line of the commit message, followed by extra
+// details, if any, truncated to the Lambda limit
+func (info *deployInfo) versionDescription(extra ...string) string {
+	var parts []string
+	if info.commit != "" {
+		s := info.commit[:min(len(info.commit), 12)]
+		if info.dirty {
+			s += "-dirty"
+		}
+		if info.subject != "" {
+			s += " " + info.subject
+		}
+		parts = append(parts, s)
+	}
+	for _, s := range extra {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	desc := []rune(strings.Join(parts, "; "))
+	if len(desc) > 256 {
+		desc = append(desc[:255], '…')
+	}
+	return string(desc)
+}
+
+// deployRecord describes a single deploy of the function version
+type deployRecord struct {
+	Function   string    `json:"function"` // qualified ARN of the published version
+	Version    string    `json:"version"`
+	CodeSha256 string    `json:"codeSha256"`
+	Commit     string    `json:"commit,omitempty"`
+	Branch     string    `json:"branch,omitempty"`
+	Subject    string    `json:"subject,omitempty"` // first line of the commit message
+	Dirty      bool      `json:"dirty,omitempty"`
+	Caller     string    `json:"caller"`
+	Start      time.Time `json:"start"`
+	Duration   float64   `json:"durationSeconds"`
+}
+
+// deployRecord returns the record of the t.version deploy
+func (t *target) deployRecord(ctx context.Context) (*deployRecord, error) {
+	if t.record != nil {
+		return t.record, nil
+	}
+	cfg, err := t.svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &t.name,
+		Qualifier:    &t.version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	caller, err := t.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.record = &deployRecord{
+		Function:   aws.ToString(cfg.FunctionArn),
+		Version:    t.version,
+		CodeSha256: aws.ToString(cfg.CodeSha256),
+		Commit:     t.deploy.commit,
+		Branch:     t.deploy.branch,
+		Subject:    t.deploy.subject,
+		Dirty:      t.deploy.dirty,
+		Caller:     caller,
+		Start:      t.deploy.start,
+		Duration:   time.Since(t.deploy.start).Seconds(),
+	}
+	return t.record, nil
+}
+
+// caller returns ARN of the identity publishing to the target
+func (t *target) caller(ctx context.Context) (string, error) {
+	if t.callerArn != "" {
+		return t.callerArn, nil
+	}
+	out, err := sts.NewFromConfig(t.awsCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("GetCallerIdentity: %w", err)
+	}
+	t.callerArn = aws.ToString(out.Arn)
+	return t.callerArn, nil
+}
+
+// recordDeploy records details of the successful publish of t.version.
+// Failures to tag the function are only logged, since the function is already
+// published by then, but failures to write the audit record or send the event
+// are errors, as something may depend on them.
+func (t *target) recordDeploy(ctx context.Context, args *runArgs) error {
+	if t.version == "" || args.dryRun {
+		return nil
+	}
+	if args.tagPrefix != "" {
+		if err := t.tagDeploy(ctx, args.tagPrefix); err != nil {
+			t.warnf("tagging function: %v", err)
+		}
+	}
+	if args.audit != nil {
+		if err := t.audit(ctx, args.audit); err != nil {
+			return fmt.Errorf("version %s is published, but writing audit record failed: %w", t.version, err)
+		}
+	}
+	if args.sbom != nil {
+		if err := t.writeSBOM(ctx, args.sbom); err != nil {
+			return fmt.Errorf("version %s is published, but writing SBOM failed: %w", t.version, err)
+		}
+	}
+	if args.provenance != nil {
+		if err := t.writeProvenance(ctx, args); err != nil {
+			return fmt.Errorf("version %s is published, but writing provenance failed: %w", t.version, err)
+		}
+	}
+	if args.cosign != nil {
+		if err := t.writeCosignBundle(ctx, args.cosign); err != nil {
+			return fmt.Errorf("version %s is published, but writing cosign bundle failed: %w", t.version, err)
+		}
+	}
+	if args.eventBus != "" {
+		if err := t.sendEvent(ctx, args.eventBus); err != nil {
+			return fmt.Errorf("version %s is published, but sending event failed: %w", t.version, err)
+		}
+	}
+	return nil
+}
+
+// sendEvent sends the deploy record to the EventBridge bus, as the detail of
+// the publish-go-lambda.Deployed event
+func (t *target) sendEvent(ctx context.Context, bus string) error {
+	rec, err := t.deployRecord(ctx)
+	if err != nil {
+		return err
+	}
+	detail, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	out, err := eventbridge.NewFromConfig(t.awsCfg).PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: &bus,
+			Source:       aws.String("publish-go-lambda"),
+			DetailType:   aws.String("publish-go-lambda.Deployed"),
+			Detail:       aws.String(string(detail)),
+			Resources:    []string{rec.Function},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("EventBridge PutEvents: %w", err)
+	}
+	if out.FailedEntryCount != 0 && len(out.Entries) != 0 {
+		return fmt.Errorf("EventBridge PutEvents: %s: %s",
+			aws.ToString(out.Entries[0].ErrorCode), aws.ToString(out.Entries[0].ErrorMessage))
+	}
+	return nil
+}
+
+// tagDeploy tags function with the published version, git commit, branch,
+// deployer identity, and time of the deploy
+func (t *target) tagDeploy(ctx context.Context, prefix string) error {
+	tags := map[string]string{
+		prefix + "version": t.version,
+		prefix + "at":      t.deploy.start.UTC().Format(time.RFC3339),
+	}
+	if by, err := t.caller(ctx); err == nil {
+		tags[prefix+"by"] = by
+	} else {
+		t.warnf("%v", err)
+	}
+	if t.deploy.commit != "" {
+		sha := t.deploy.commit
+		if t.deploy.dirty {
+			sha += "-dirty"
+		}
+		tags[prefix+"sha"] = sha
+	}
+	if t.deploy.branch != "" {
+		tags[prefix+"branch"] = tagValue(t.deploy.branch)
+	}
+	fnArn := t.unqualifiedArn()
+	if _, err := t.svc.TagResource(ctx, &lambda.TagResourceInput{Resource: &fnArn, Tags: tags}); err != nil {
+		return fmt.Errorf("TagResource: %w", err)
+	}
+	return nil
+}
+
+// tagValue replaces characters not allowed in AWS tag values with dashes,
+// and truncates value to the 256 characters limit
+func tagValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(" _.:/=+-@", r):
+			return r
+		}
+		return '-'
+	}, s)
+	if len(s) > 256 {
+		s = s[:256]
+	}
+	return s
+}
+
+// originURL returns URL of the git remote with the credentials, like the
+// tokens CI systems put there, removed
+func originURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// runtimeDeprecations is the published deprecation schedule of the runtimes
+// Go functions can use, see
+// https://docs.aws.amazon.com/lambda/latest/dg/lambda-runtimes.html#runtimes-deprecated
+var runtimeDeprecations = map[types.Runtime]struct {
+	deprecated  string // date of deprecation
+	blockUpdate string // date from which function updates are blocked
+	advice      string
+}{
+	types.RuntimeGo1x: {"2024-01-08", "2026-03-09",
+		"migrate function to the " + string(types.RuntimeProvidedal2023) + " runtime with -migrate-runtime flag"},
+	types.RuntimeProvidedal2: {"2026-06-30", "2026-08-31",
+		"switch function to the " + string(types.RuntimeProvidedal2023) + " runtime"},
+}
+
+// runtimeStatus describes the deprecation status of the runtime at the time
+// now, if it is deprecated or going to be deprecated in the next 6 months.
+// Otherwise it returns an empty string.
+func runtimeStatus(runtime types.Runtime, now time.Time) (msg string, deprecated bool) {
+	d, ok := runtimeDeprecations[runtime]
+	if !ok {
+		return "", false
+	}
+	deprecation, _ := time.Parse(time.DateOnly, d.deprecated)
+	blockUpdate, _ := time.Parse(time.DateOnly, d.blockUpdate)
+	switch {
+	case now.Before(deprecation.AddDate(0, -6, 0)):
+		return "", false
+	case now.Before(deprecation):
+		return fmt.Sprintf("%s runtime will be deprecated on %s, and function updates blocked from %s; %s",
+			runtime, d.deprecated, d.blockUpdate, d.advice), false
+	case now.Before(blockUpdate):
+		return fmt.Sprintf("%s runtime is deprecated since %s, function updates will be blocked from %s; %s",
+			runtime, d.deprecated, d.blockUpdate, d.advice), true
+	}
+	return fmt.Sprintf("%s runtime is deprecated since %s, and function updates are blocked since %s; %s",
+		runtime, d.deprecated, d.blockUpdate, d.advice), true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// packageDeps lists local inputs of a Go package build
+type packageDeps struct {
+	dirs  []string // directories of the package and its local dependencies
+	files []string // other files affecting the build: go.mod, go.sum, embedded files
+}
+
+// localDeps returns directories of the package in dir and all its
+// non-standard dependencies that are part of the main module(s) or are
+// replaced with local directories, as well as other local files affecting
+// the build. Dependencies are resolved for linux and given build tags.
+func localDeps(ctx context.Context, dir string, tags []string) (*packageDeps, error) {
+	const format = `{{if and (not .Standard) .Module}}` +
+		`{{if or .Module.Main (and .Module.Replace (not .Module.Replace.Version))}}` +
+		`D {{.Dir}}{{"\n"}}` +
+		`{{range .EmbedFiles}}F {{$.Dir}}/{{.}}{{"\n"}}{{end}}` +
+		`{{with .Module.GoMod}}F {{.}}{{"\n"}}{{end}}` +
+		`{{end}}{{end}}`
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-deps",
+		"-tags="+strings.Join(tags, ","), "-f", format, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	deps := new(packageDeps)
+	seen := make(map[string]struct{})
+	add := func(list *[]string, s string) {
+		if _, ok := seen[s]; ok {
+			return
+		}
+		seen[s] = struct{}{}
+		*list = append(*list, s)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		kind, name, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		name = filepath.Clean(name)
+		switch kind {
+		case "D":
+			add(&deps.dirs, name)
+		case "F":
+			add(&deps.files, name)
+			if filepath.Base(name) == "go.mod" {
+				add(&deps.files, filepath.Join(filepath.Dir(name), "go.sum"))
+			}
+		}
+	}
+	return deps, sc.Err()
+}
+
+// watchDirs returns directories to watch for changes to detect that the
+// build inputs have changed
+func (deps *packageDeps) watchDirs() []string {
+	seen := make(map[string]struct{})
+	var out []string
+	for _, d := range deps.dirs {
+		seen[d] = struct{}{}
+		out = append(out, d)
+	}
+	for _, f := range deps.files {
+		d := filepath.Dir(f)
+		if _, ok := seen[d]; ok {
+			continue
+		}
+		seen[d] = struct{}{}
+		out = append(out, d)
+	}
+	return out
+}
+
+// affectedBy reports whether any of the files (absolute paths) is an input of
+// the build
+func (deps *packageDeps) affectedBy(files []string) bool {
+	dirs := make(map[string]struct{}, len(deps.dirs))
+	for _, d := range deps.dirs {
+		dirs[d] = struct{}{}
+	}
+	inputs := make(map[string]struct{}, len(deps.files))
+	for _, f := range deps.files {
+		inputs[f] = struct{}{}
+	}
+	for _, f := range files {
+		if _, ok := inputs[f]; ok {
+			return true
+		}
+		if _, ok := dirs[filepath.Dir(f)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// changedSince returns absolute paths of files in the git repository holding
+// dir that differ from the given git ref, including untracked files
+func changedSince(ctx context.Context, dir, ref string) ([]string, error) {
+	git := func(args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Stderr = os.Stderr
+		return cmd.Output()
+	}
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSpace(string(top))
+	diff, err := git("-C", root, "diff", "--name-only", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git("-C", root, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, b := range bytes.Split(append(diff, untracked...), []byte{0}) {
+		if len(b) != 0 {
+			out = append(out, filepath.Join(root, string(b)))
+		}
+	}
+	return out, nil
+}
+
+// packageImports returns import paths of the package in dir and all its
+// dependencies, resolved for linux, given arch, and build tags
+func packageImports(ctx context.Context, dir, arch string, tags []string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-deps",
+		"-tags="+strings.Join(tags, ","), "-f", "{{.ImportPath}}", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// defaultBuildImage is the default image for -build-in-docker builds: AWS SAM
+// build image for the provided.al2023 runtime, which has Go installed
+const defaultBuildImage = "public.ecr.aws/sam/build-provided.al2023"
+
+// buildInDocker builds Go program in dir inside the opts.image container, for
+// linux and opts.arch platform, saving resulting binary to binPath. Module
+// with the program is mounted into the container, together with the host
+// module cache.
+//
+// Container runs on the target platform, so cgo code is compiled natively
+// by the image C compiler, unless opts.cc is set.
+func buildInDocker(ctx context.Context, dir string, opts *buildOptions, binPath string) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("-build-in-docker requires docker: %w", err)
+	}
+	goEnv := func(name string) (string, error) {
+		cmd := exec.CommandContext(ctx, "go", "env", name)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		return string(bytes.TrimSpace(out)), err
+	}
+	gomod, err := goEnv("GOMOD")
+	if err != nil {
+		return fmt.Errorf("go env GOMOD: %w", err)
+	}
+	if gomod == "" || gomod == os.DevNull {
+		return errors.New("-build-in-docker only supports packages inside a Go module")
+	}
+	modCache, err := goEnv("GOMODCACHE")
+	if err != nil {
+		return fmt.Errorf("go env GOMODCACHE: %w", err)
+	}
+	root := filepath.Dir(gomod)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, absDir)
+	if err != nil {
+		return err
+	}
+	outDir, err := filepath.Abs(filepath.Dir(binPath))
+	if err != nil {
+		return err
+	}
+	args := []string{"run", "--rm", "--platform", "linux/" + opts.arch,
+		// run as the current user, so that files written to the host
+		// module cache are not owned by root
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"-v", root + ":/src:ro",
+		"-v", modCache + ":/go/pkg/mod",
+		"-v", outDir + ":/out",
+		"-w", filepath.ToSlash(filepath.Join("/src", rel)),
+		"-e", "HOME=/tmp",
+		"-e", "GOCACHE=/tmp/go-build",
+		"-e", "GOMODCACHE=/go/pkg/mod",
+		"-e", "GOFLAGS=-buildvcs=false",
+		"-e", "GOOS=linux",
+		"-e", "GOARCH=" + opts.arch,
+		"-e", "GOPROXY", "-e", "GOPRIVATE", "-e", "GONOSUMDB", "-e", "GONOPROXY",
+	}
+	if opts.toolchain != "" {
+		args = append(args, "-e", "GOTOOLCHAIN="+opts.toolchain)
+	}
+	if opts.cgo {
+		args = append(args, "-e", "CGO_ENABLED=1")
+		if opts.cc != "" {
+			args = append(args, "-e", "CC="+opts.cc)
+		}
+	} else {
+		args = append(args, "-e", "CGO_ENABLED=0")
+	}
+	pgo := opts.pgo
+	if pgo != "" && pgo != "off" {
+		args = append(args, "-v", pgo+":/pgo/default.pgo:ro")
+		pgo = "/pgo/default.pgo"
+	}
+	args = append(args, opts.image, "go")
+	args = append(args, opts.goBuildArgs(pgo, "/out/"+filepath.Base(binPath))...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker run: %w", err)
+	}
+	return nil
+}
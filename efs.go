@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// checkFileSystems makes sure EFS access points the function mounts still
+// exist, and that paths under /mnt the code refers to (refs) are under one
+// of the function mount paths, as otherwise the function fails at runtime
+func (t *target) checkFileSystems(ctx context.Context, refs []string) error {
+	var mounts []string
+	for _, fs := range t.cfg.FileSystemConfigs {
+		mounts = append(mounts, aws.ToString(fs.LocalMountPath))
+		if err := t.checkAccessPoint(ctx, aws.ToString(fs.Arn)); err != nil {
+			return fmt.Errorf("file system mounted at %s: %w", aws.ToString(fs.LocalMountPath), err)
+		}
+	}
+	var unmounted []string
+	for _, ref := range refs {
+		if !slices.ContainsFunc(mounts, func(m string) bool { return ref == m || strings.HasPrefix(ref, m+"/") }) {
+			unmounted = append(unmounted, ref)
+		}
+	}
+	if len(unmounted) != 0 {
+		return fmt.Errorf("code refers to %s, but function only mounts file systems at %s",
+			strings.Join(unmounted, ", "), strings.Join(mounts, ", "))
+	}
+	return nil
+}
+
+// checkAccessPoint returns an error if EFS access point with the given ARN
+// does not exist, or is not available
+func (t *target) checkAccessPoint(ctx context.Context, apArn string) error {
+	a, err := arn.Parse(apArn)
+	if err != nil {
+		return err
+	}
+	id, ok := strings.CutPrefix(a.Resource, "access-point/")
+	if !ok {
+		return fmt.Errorf("unsupported file system ARN %s", apArn)
+	}
+	body, err := callAPI(ctx, t.awsCfg, "elasticfilesystem", a.Region,
+		"https://elasticfilesystem."+a.Region+".amazonaws.com/2015-02-01/access-points?AccessPointId="+url.QueryEscape(id), "")
+	var out struct {
+		AccessPoints []struct{ LifeCycleState string }
+		ErrorCode    string
+	}
+	if jerr := json.Unmarshal(body, &out); jerr != nil && err == nil {
+		err = jerr
+	}
+	switch {
+	case out.ErrorCode == "AccessPointNotFound":
+		return fmt.Errorf("access point %s no longer exists", id)
+	case err != nil:
+		return fmt.Errorf("DescribeAccessPoints: %w", err)
+	case len(out.AccessPoints) == 0:
+		return fmt.Errorf("access point %s no longer exists", id)
+	case out.AccessPoints[0].LifeCycleState != "available":
+		return fmt.Errorf("access point %s is %s", id, out.AccessPoints[0].LifeCycleState)
+	}
+	return nil
+}
+
+// mountPathRe matches string literals with paths under /mnt, where Lambda
+// mounts file systems
+var mountPathRe = regexp.MustCompile("[\"`](/mnt/[^\"`\\s]+)[\"`]")
+
+// mountPathRefs returns sorted paths under /mnt that Go files of the package
+// in dir and its local dependencies refer to in string literals. This is a
+// simple text scan, paths built at runtime are not detected.
+func mountPathRefs(ctx context.Context, dir string, tags []string) ([]string, error) {
+	deps, err := localDeps(ctx, dir, tags)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, d := range deps.dirs {
+		files, err := filepath.Glob(filepath.Join(d, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range files {
+			if strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			b, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range mountPathRe.FindAllSubmatch(b, -1) {
+				out = append(out, filepath.Clean(string(m[1])))
+			}
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// parseEnvFile parses file of KEY=VALUE lines, in the format commonly used
+// for .env files: empty lines and lines starting with # are ignored, keys may
+// be prefixed with "export", and values may be quoted. Double-quoted values
+// are unquoted the same way as Go string literals are.
+func parseEnvFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	env := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", name, n)
+		}
+		switch {
+		case len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"':
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+			}
+		case len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// syncEnvironment merges args.env into the function environment variables,
+// overwriting variables with the same names, so that the code is published
+// with the configuration it expects
+func (t *target) syncEnvironment(ctx context.Context, args *runArgs) error {
+	var current map[string]string
+	if t.cfg.Environment != nil {
+		current = t.cfg.Environment.Variables
+	}
+	var changed []string
+	for k, v := range args.env {
+		if cur, ok := current[k]; !ok || cur != v {
+			changed = append(changed, k)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	slices.Sort(changed)
+	// values are not logged, as they may be secrets
+	if args.dryRun {
+		t.logf("dry run, would set environment variables: %s", strings.Join(changed, ", "))
+		return nil
+	}
+	t.logf("setting environment variables: %s", strings.Join(changed, ", "))
+	vars := maps.Clone(current)
+	if vars == nil {
+		vars = make(map[string]string, len(args.env))
+	}
+	maps.Copy(vars, args.env)
+	return t.updateConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		Environment: &types.Environment{Variables: vars},
+	})
+}
+
+// checkEnvDrift compares the function environment variables with args.envCheck
+// definition, logging the variables that differ. If there are any, it asks
+// whether to publish anyway when run interactively, and fails otherwise, so
+// that code is not published to the function which configuration was changed
+// from the one the code expects, like in the console.
+func (t *target) checkEnvDrift(args *runArgs) error {
+	if t.cfg == nil {
+		return nil // to be created
+	}
+	var current map[string]string
+	if t.cfg.Environment != nil {
+		current = t.cfg.Environment.Variables
+	}
+	names := slices.Collect(maps.Keys(args.envCheck))
+	for k := range current {
+		if _, ok := args.envCheck[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	slices.Sort(names)
+	var drift int
+	for _, k := range names {
+		want, wantOk := args.envCheck[k]
+		have, haveOk := current[k]
+		// values are not logged, as they may be secrets
+		switch {
+		case !haveOk:
+			t.warnf("environment drift: %s is not set on the function", k)
+		case !wantOk:
+			t.warnf("environment drift: %s is set on the function, but not expected", k)
+		case have != want:
+			t.warnf("environment drift: %s has a different value on the function", k)
+		default:
+			continue
+		}
+		drift++
+	}
+	switch {
+	case drift == 0:
+		return nil
+	case args.dryRun:
+		t.logf("dry run, environment of the function differs from the expected one in %d variables", drift)
+		return nil
+	case interactive():
+		prompt := "Environment of the function differs from the expected one, publish anyway?"
+		if t.label != "" {
+			prompt = t.label + ": " + prompt
+		}
+		if confirm(prompt) {
+			return nil
+		}
+	}
+	return fmt.Errorf("environment of the function differs from the expected one in %d variables", drift)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// Exit codes of the program
+const (
+	exitFailure    = 1 // any failure not covered by other codes
+	exitInvalid    = 2 // invalid flags or arguments, or failed safety checks
+	exitBuild      = 3 // failed build, or checks and tests run before it
+	exitAWS        = 4 // failed AWS API call
+	exitUnchanged  = 5 // nothing to deploy, only with -detailed-exitcode flag
+	exitDeprecated = 6 // function uses deprecated runtime, only with -fail-deprecated flag
+)
+
+// errNothingToDeploy is returned by run with -detailed-exitcode flag if no
+// target got a new version because the deployed code is already up to date
+var errNothingToDeploy = errors.New("nothing to deploy")
+
+// exitError is an error that makes program exit with the specific code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode wraps non-nil err, so that program exits with code if it fails
+// with this error
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns code program should exit with if it fails with err
+func exitCode(err error) int {
+	var e *exitError
+	var oe *smithy.OperationError
+	switch {
+	case errors.Is(err, errNothingToDeploy):
+		return exitUnchanged
+	case errors.As(err, &e):
+		return e.code
+	case errors.As(err, &oe):
+		return exitAWS
+	}
+	return exitFailure
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// extensionSpecs converts extension packages in pkg[:name] form to the
+// buildHelpers specs placing binaries in the extensions directory, where
+// Lambda looks for the external extensions
+func extensionSpecs(list []string) ([]string, error) {
+	var out []string
+	for _, s := range list {
+		pkg, name, _ := strings.Cut(s, ":")
+		if name == "" {
+			abs, err := filepath.Abs(pkg)
+			if err != nil {
+				return nil, err
+			}
+			name = filepath.Base(abs)
+		}
+		out = append(out, pkg+":extensions/"+name)
+	}
+	return out, nil
+}
+
+// extensionsLayer returns the name of the layer to publish extensions to
+func (t *target) extensionsLayer(args *runArgs) string {
+	if args.extensionsLayer != "" {
+		return args.extensionsLayer
+	}
+	name := t.name
+	if t.cfg != nil {
+		name = aws.ToString(t.cfg.FunctionName)
+	}
+	return name + "-extensions"
+}
+
+// publishExtensions publishes a new version of the extensions layer
+func (t *target) publishExtensions(ctx context.Context, args *runArgs, archs []types.Architecture) (*lambda.PublishLayerVersionOutput, error) {
+	data, err := zipFiles(t.extensions)
+	if err != nil {
+		return nil, err
+	}
+	layerName := t.extensionsLayer(args)
+	out, err := t.svc.PublishLayerVersion(ctx, &lambda.PublishLayerVersionInput{
+		LayerName:               &layerName,
+		Content:                 &types.LayerVersionContentInput{ZipFile: data},
+		CompatibleArchitectures: archs,
+		Description:             aws.String("extensions of " + t.name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("PublishLayerVersion: %w", err)
+	}
+	t.logf("published %s", aws.ToString(out.LayerVersionArn))
+	return out, nil
+}
+
+// syncExtensions makes sure the function uses the extensions layer with the
+// content of t.extensions: if the function already has the layer version with
+// the same content, nothing is done, otherwise new layer version is published
+// and attached to the function.
+//
+// Lambda only runs external extensions from the /opt/extensions directory,
+// which is populated from layers, so extensions cannot be put into the
+// function package itself.
+func (t *target) syncExtensions(ctx context.Context, args *runArgs) error {
+	data, err := zipFiles(t.extensions)
+	if err != nil {
+		return err
+	}
+	layerName := t.extensionsLayer(args)
+	fnArn := aws.ToString(t.cfg.FunctionArn)
+	i := strings.Index(fnArn, ":function:")
+	if i == -1 {
+		return fmt.Errorf("unexpected function ARN format: %q", fnArn)
+	}
+	layerArn := fnArn[:i] + ":layer:" + layerName
+	sum := sha256.Sum256(data)
+	codeSha256 := base64.StdEncoding.EncodeToString(sum[:])
+	for _, l := range t.cfg.Layers {
+		if !strings.HasPrefix(aws.ToString(l.Arn), layerArn+":") {
+			continue
+		}
+		out, err := t.svc.GetLayerVersionByArn(ctx, &lambda.GetLayerVersionByArnInput{Arn: l.Arn})
+		if err != nil {
+			return fmt.Errorf("GetLayerVersionByArn: %w", err)
+		}
+		if out.Content != nil && aws.ToString(out.Content.CodeSha256) == codeSha256 {
+			return nil
+		}
+	}
+	if args.dryRun {
+		t.logf("extensions changed, would publish new version of layer %s (%d bytes)", layerName, len(data))
+		return nil
+	}
+	out, err := t.publishExtensions(ctx, args, []types.Architecture{lambdaArch(t.arch)})
+	if err != nil {
+		return err
+	}
+	return t.updateConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		Layers: withLayer(t.cfg.Layers, aws.ToString(out.LayerArn), aws.ToString(out.LayerVersionArn)),
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// ensureFunctionURL makes sure the function has a Function URL with the
+// args.functionURL auth type, attached to args.alias if it is set, so that
+// the URL serves the same version the alias does. With NONE auth type, it
+// also adds permissions allowing anyone to invoke the function through the
+// URL.
+func (t *target) ensureFunctionURL(ctx context.Context, args *runArgs) error {
+	var qualifier *string
+	where := "function"
+	if args.alias != "" {
+		qualifier, where = &args.alias, "alias "+args.alias
+	}
+	var cfg *lambda.GetFunctionUrlConfigOutput
+	if t.cfg != nil {
+		var err error
+		cfg, err = t.svc.GetFunctionUrlConfig(ctx, &lambda.GetFunctionUrlConfigInput{FunctionName: &t.name, Qualifier: qualifier})
+		var notFound *types.ResourceNotFoundException
+		if err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("GetFunctionUrlConfig: %w", err)
+		}
+	}
+	switch {
+	case cfg != nil && cfg.AuthType == args.functionURL:
+		t.functionURL = aws.ToString(cfg.FunctionUrl)
+	case args.dryRun && cfg != nil:
+		t.logf("dry run, would change auth type of the %s URL from %s to %s", where, cfg.AuthType, args.functionURL)
+		return nil
+	case args.dryRun:
+		t.logf("dry run, would create %s URL with %s auth type", where, args.functionURL)
+		return nil
+	case cfg != nil:
+		t.logf("changing auth type of the %s URL from %s to %s", where, cfg.AuthType, args.functionURL)
+		out, err := t.svc.UpdateFunctionUrlConfig(ctx, &lambda.UpdateFunctionUrlConfigInput{
+			FunctionName: &t.name,
+			Qualifier:    qualifier,
+			AuthType:     args.functionURL,
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateFunctionUrlConfig: %w", err)
+		}
+		t.functionURL = aws.ToString(out.FunctionUrl)
+	default:
+		out, err := t.svc.CreateFunctionUrlConfig(ctx, &lambda.CreateFunctionUrlConfigInput{
+			FunctionName: &t.name,
+			Qualifier:    qualifier,
+			AuthType:     args.functionURL,
+		})
+		if err != nil {
+			return fmt.Errorf("CreateFunctionUrlConfig: %w", err)
+		}
+		t.functionURL = aws.ToString(out.FunctionUrl)
+		t.logf("created %s URL with %s auth type", where, args.functionURL)
+	}
+	if args.functionURL == types.FunctionUrlAuthTypeNone {
+		if err := t.allowPublicURL(ctx, qualifier); err != nil {
+			return err
+		}
+	}
+	t.logf("function URL: %s", t.functionURL)
+	if args.alias != "" {
+		// URL of the unqualified function serves $LATEST, not the alias
+		out, err := t.svc.GetFunctionUrlConfig(ctx, &lambda.GetFunctionUrlConfigInput{FunctionName: &t.name})
+		if err == nil {
+			t.warnf("function also has URL %s, which serves $LATEST version rather than alias %s",
+				aws.ToString(out.FunctionUrl), args.alias)
+		}
+	}
+	return nil
+}
+
+// allowPublicURL adds resource-based policy statements that allow invoking
+// the function through its URL with NONE auth type, like the console does.
+// Statements that already exist are left as is.
+func (t *target) allowPublicURL(ctx context.Context, qualifier *string) error {
+	for _, in := range []*lambda.AddPermissionInput{{
+		StatementId:         aws.String("FunctionURLAllowPublicAccess"),
+		Action:              aws.String("lambda:InvokeFunctionUrl"),
+		FunctionUrlAuthType: types.FunctionUrlAuthTypeNone,
+	}, {
+		StatementId:           aws.String("FunctionURLAllowInvokeAction"),
+		Action:                aws.String("lambda:InvokeFunction"),
+		InvokedViaFunctionUrl: aws.Bool(true),
+	}} {
+		in.FunctionName, in.Qualifier, in.Principal = &t.name, qualifier, aws.String("*")
+		_, err := t.svc.AddPermission(ctx, in)
+		var conflict *types.ResourceConflictException
+		if err != nil && !errors.As(err, &conflict) {
+			return fmt.Errorf("AddPermission: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+// gitOutput runs git command in dir, returning its trimmed output
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// checkGitState verifies that the git working tree dir belongs to has no
+// uncommitted changes, and its HEAD commit is pushed to some remote branch.
+// If dir is not inside a git repository, check passes.
+func checkGitState(ctx context.Context, dir string) error {
+	if _, err := gitOutput(ctx, dir, "rev-parse", "--git-dir"); err != nil {
+		return nil
+	}
+	status, err := gitOutput(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return errors.New("git working tree has uncommitted changes, commit them or use -f to publish anyway")
+	}
+	remote, err := gitOutput(ctx, dir, "branch", "--remotes", "--contains", "HEAD")
+	if err != nil {
+		return err
+	}
+	if remote == "" {
+		return errors.New("git HEAD commit is not pushed to any remote branch, push it or use -f to publish anyway")
+	}
+	return nil
+}
+
+// releaseTag returns the name of an annotated (or signed) git tag matching
+// pattern that points to HEAD of the repository dir belongs to
+func releaseTag(ctx context.Context, dir, pattern string) (string, error) {
+	out, err := gitOutput(ctx, dir, "for-each-ref", "--points-at", "HEAD",
+		"--format", "%(objecttype) %(refname:short)", "refs/tags/")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		typ, name, _ := strings.Cut(line, " ")
+		if typ != "tag" { // lightweight tags point to commits directly
+			continue
+		}
+		if ok, err := path.Match(pattern, name); err != nil {
+			return "", fmt.Errorf("invalid tag pattern %q: %w", pattern, err)
+		} else if ok {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("HEAD has no annotated git tag matching %q", pattern)
+}
+
+// checkRelease verifies that the target function can be published from the
+// current git HEAD: if function has the protected tag, HEAD must have
+// an annotated tag matching args.releaseTag pattern
+func (t *target) checkRelease(ctx context.Context, args *runArgs) error {
+	if t.cfg == nil {
+		return nil // to be created
+	}
+	fnArn := t.unqualifiedArn()
+	out, err := t.svc.ListTags(ctx, &lambda.ListTagsInput{Resource: &fnArn})
+	if err != nil {
+		return fmt.Errorf("ListTags: %w", err)
+	}
+	key, value, _ := strings.Cut(args.protectedTag, "=")
+	if v, ok := out.Tags[key]; !ok || v != value {
+		return nil
+	}
+	tag, err := releaseTag(ctx, args.dir, args.releaseTag)
+	if err != nil {
+		return fmt.Errorf("function is tagged %s, refusing to publish: %w", args.protectedTag, err)
+	}
+	t.logf("publishing protected function from git tag %s", tag)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// githubActions reports the outcome of publishing to the targets to GitHub
+// Actions, if the program runs there: it prints workflow annotations for
+// each target that failed or got a new version, and writes step outputs to
+// the $GITHUB_OUTPUT file.
+//
+// Outputs are version, function-arn, code-sha256, and function-url (with
+// -function-url flag) of the first target that got a new version, and result
+// with the same JSON document -json prints.
+func githubActions(name string, start time.Time, targets []*target) error {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return nil
+	}
+	for _, t := range targets {
+		switch {
+		case t.err != nil:
+			fmt.Fprintf(os.Stderr, "::error title=%s::%s\n",
+				ghEscape("publishing "+name+" to "+t.where()+" failed", true), ghEscape(t.err.Error(), false))
+		case t.version != "":
+			fmt.Fprintf(os.Stderr, "::notice title=%s::%s\n",
+				ghEscape("published "+name, true), ghEscape("version "+t.version+" in "+t.where(), false))
+		}
+	}
+	file := os.Getenv("GITHUB_OUTPUT")
+	if file == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, t := range targets {
+		if t.version == "" {
+			continue
+		}
+		r := t.result()
+		fmt.Fprintf(&buf, "version=%s\nfunction-arn=%s\ncode-sha256=%s\n", r.Version, r.FunctionArn, r.CodeSha256)
+		if r.FunctionURL != "" {
+			fmt.Fprintf(&buf, "function-url=%s\n", r.FunctionURL)
+		}
+		break
+	}
+	buf.WriteString("result=")
+	if err := writeResult(&buf, name, start, targets); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ghEscape escapes s for use in GitHub Actions workflow command message, or
+// property value if property is set
+func ghEscape(s string, property bool) string {
+	r := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	if property {
+		r = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	}
+	return r.Replace(s)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+)
+
+func historyCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	prefix := fs.String("tag-prefix", "deploy:", "`prefix` of the deploy tags")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s history [flags] aws-lambda-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Lists published function versions in chronological order, with git commits\n"+
+			"they were built from, and the details of the latest deploy from the function tags.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("name must be set"))
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	svc := lambda.NewFromConfig(cfg)
+	fn, err := svc.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: &name})
+	if err != nil {
+		return fmt.Errorf("GetFunction: %w", err)
+	}
+	tags := fn.Tags
+	versions, err := publishedVersions(ctx, svc, name)
+	if err != nil {
+		return err
+	}
+	aliases, err := versionAliases(ctx, svc, name)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tPUBLISHED\tCOMMIT\tBY\tALIASES\tMESSAGE")
+	for _, v := range versions {
+		version := aws.ToString(v.Version)
+		published, by := aws.ToString(v.LastModified), "-"
+		if tags[*prefix+"version"] == version {
+			if at := tags[*prefix+"at"]; at != "" {
+				published = at
+			}
+			if s := tags[*prefix+"by"]; s != "" {
+				by = s
+			}
+		}
+		commit, message := parseDescription(aws.ToString(v.Description))
+		if commit == "" {
+			commit = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			version,
+			published,
+			commit,
+			by,
+			strings.Join(aliases[version], ","),
+			message,
+		)
+	}
+	return tw.Flush()
+}
+
+// parseDescription splits version description set by
+// deployInfo.versionDescription into the commit SHA and the rest. If
+// description does not start with a commit SHA, it is returned as is.
+func parseDescription(desc string) (commit, rest string) {
+	sha, rest, _ := strings.Cut(desc, " ")
+	hex := strings.TrimSuffix(sha, "-dirty")
+	if len(hex) != 12 || strings.Trim(hex, "0123456789abcdef") != "" {
+		return "", desc
+	}
+	return sha, rest
+}
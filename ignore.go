@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreFile is the name of the file in the package directory listing
+// patterns of files that must not be bundled in the package
+const ignoreFile = ".lambdaignore"
+
+// ignoreRules is a list of rules from the ignore file. File holds one pattern
+// per line, empty lines and lines starting with # are skipped. Patterns use
+// path.Match syntax and are matched against slash-separated paths of files
+// inside the archive, and paths of their parent directories:
+//
+//   - pattern without a slash matches a file or directory with such name
+//     anywhere in the archive, like "*.log";
+//   - pattern with a slash matches the path from the archive root, like
+//     "data/fixtures" or "/testdata";
+//   - pattern ending with a slash only matches directories;
+//   - pattern starting with ! re-includes what previous patterns excluded.
+//
+// The last matching pattern wins.
+type ignoreRules []ignoreRule
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // match the full path instead of the base name
+}
+
+// loadIgnoreRules reads rules from the file, missing file is not an error
+func loadIgnoreRules(name string) (ignoreRules, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules ignoreRules
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if r.negate = strings.HasPrefix(line, "!"); r.negate {
+			line = line[1:]
+		}
+		if r.dirOnly = strings.HasSuffix(line, "/"); r.dirOnly {
+			line = strings.TrimRight(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		r.pattern = strings.TrimPrefix(line, "/")
+		if _, err := path.Match(r.pattern, ""); err != nil || r.pattern == "" {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q", name, n, sc.Text())
+		}
+		rules = append(rules, r)
+	}
+	return rules, sc.Err()
+}
+
+// ignored reports whether file with the given archive path is excluded by
+// the rules
+func (rules ignoreRules) ignored(name string) bool {
+	var ignored bool
+	for _, r := range rules {
+		if r.match(name) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) match(name string) bool {
+	elems := strings.Split(name, "/")
+	for i := len(elems); i > 0; i-- {
+		if r.dirOnly && i == len(elems) {
+			continue
+		}
+		s := elems[i-1]
+		if r.anchored {
+			s = strings.Join(elems[:i], "/")
+		}
+		if ok, _ := path.Match(r.pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns entries not excluded by the rules
+func (rules ignoreRules) filter(entries []zipEntry) []zipEntry {
+	if len(rules) == 0 {
+		return entries
+	}
+	var out []zipEntry
+	for _, e := range entries {
+		if !rules.ignored(e.name) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
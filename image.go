@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// resolveImage prepares target for publishing the Image type packaged
+// function: its code is pushed to the same ECR repository the function image
+// currently comes from
+func (t *target) resolveImage(ctx context.Context, cfg *lambda.GetFunctionConfigurationOutput) error {
+	if len(cfg.Architectures) != 1 {
+		return fmt.Errorf("expected single supported architecture, got %v", cfg.Architectures)
+	}
+	switch arch := cfg.Architectures[0]; arch {
+	case types.ArchitectureX8664:
+		t.arch = goAmd64
+	case types.ArchitectureArm64:
+		t.arch = goArm64
+	default:
+		return fmt.Errorf("unsupported architecture %v", arch)
+	}
+	fn, err := t.svc.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: &t.name})
+	if err != nil {
+		return fmt.Errorf("GetFunction: %w", err)
+	}
+	if fn.Code == nil || fn.Code.ImageUri == nil {
+		return errors.New("cannot find image URI of the function")
+	}
+	// image URI is either repository:tag, or repository@sha256:digest
+	repo := *fn.Code.ImageUri
+	if i := strings.LastIndexByte(repo, '@'); i != -1 {
+		repo = repo[:i]
+	} else if i := strings.LastIndexByte(repo, ':'); i > strings.LastIndexByte(repo, '/') {
+		repo = repo[:i]
+	}
+	t.cfg, t.binaryName, t.imageRepo = cfg, "bootstrap", repo
+	return nil
+}
+
+// updateImage builds container image with the target binary on top of the
+// args.baseImage, pushes it to the function's ECR repository, and updates
+// function to use it. It returns the published version, or an empty string
+// if the function already uses the same image.
+//
+// It requires docker command line tool.
+func (t *target) updateImage(ctx context.Context, args *runArgs) (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", fmt.Errorf("docker is required to publish Image type packaged Lambdas: %w", err)
+	}
+	sum, err := entriesSha256(append(t.entries[:len(t.entries):len(t.entries)], t.extensions...))
+	if err != nil {
+		return "", err
+	}
+	tag := t.imageRepo + ":publish-go-lambda-" + sum[:16]
+	if args.dryRun {
+		t.logf("dry run, not updating function %s", aws.ToString(t.cfg.FunctionArn))
+		t.logf("image:\t%s (from %s, %s)", tag, args.baseImage, t.archChange())
+		t.logf("revision id:\t%s", aws.ToString(t.cfg.RevisionId))
+		return "", nil
+	}
+	dir, err := os.MkdirTemp("", "publish-go-lambda-image-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	for _, e := range t.entries {
+		dst := filepath.Join(dir, "root", filepath.FromSlash(e.name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			return "", err
+		}
+		if err := copyFile(dst, e.path, e.mode); err != nil {
+			return "", err
+		}
+	}
+	dockerfile := "FROM " + args.baseImage + "\nCOPY root/ /var/task/\n"
+	if len(t.extensions) != 0 {
+		// layers are not supported for container images, extensions go to
+		// the same place the layer would put them
+		for _, e := range t.extensions {
+			dst := filepath.Join(dir, "opt", filepath.FromSlash(e.name))
+			if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+				return "", err
+			}
+			if err := copyFile(dst, e.path, e.mode); err != nil {
+				return "", err
+			}
+		}
+		dockerfile += "COPY opt/ /opt/\n"
+	}
+	dockerfile += "ENTRYPOINT [\"/var/task/bootstrap\"]\n"
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0666); err != nil {
+		return "", err
+	}
+	if err := t.dockerLogin(ctx); err != nil {
+		return "", err
+	}
+	if err := docker(ctx, nil, "build", "--platform", "linux/"+t.arch, "--provenance=false", "-t", tag, dir); err != nil {
+		return "", err
+	}
+	if err := docker(ctx, nil, "push", tag); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := docker(ctx, &out, "image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", tag); err != nil {
+		return "", err
+	}
+	var imageURI string
+	for _, s := range strings.Fields(out.String()) {
+		if strings.HasPrefix(s, t.imageRepo+"@") {
+			imageURI = s
+			break
+		}
+	}
+	if imageURI == "" {
+		return "", fmt.Errorf("cannot find digest of the pushed image %s", tag)
+	}
+	// for Image type packaged functions CodeSha256 is the image digest
+	digest := imageURI[strings.LastIndexByte(imageURI, ':')+1:]
+	t.codeSha256 = digest
+	if digest == aws.ToString(t.cfg.CodeSha256) {
+		if t.configChanged {
+			return t.publishVersion(ctx, t.cfg.CodeSha256, t.cfg.RevisionId)
+		}
+		t.logf("function image is up to date (%s), nothing to publish", imageURI)
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, args.timeout)
+	defer cancel()
+	return t.publishCode(ctx, args, &lambda.UpdateFunctionCodeInput{ImageUri: &imageURI})
+}
+
+// dockerLogin authenticates docker to the ECR registry of the target image
+// repository
+func (t *target) dockerLogin(ctx context.Context) error {
+	out, err := ecr.NewFromConfig(t.awsCfg).GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return fmt.Errorf("ECR GetAuthorizationToken: %w", err)
+	}
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return errors.New("ECR returned no authorization data")
+	}
+	token, err := base64.StdEncoding.DecodeString(*out.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return err
+	}
+	user, password, ok := strings.Cut(string(token), ":")
+	if !ok {
+		return errors.New("unexpected ECR authorization token format")
+	}
+	registry := t.imageRepo[:strings.IndexByte(t.imageRepo+"/", '/')]
+	cmd := exec.CommandContext(ctx, "docker", "login", "--username", user, "--password-stdin", registry)
+	cmd.Stdin = strings.NewReader(password)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker login: %w", err)
+	}
+	return nil
+}
+
+// docker runs docker command with the given arguments, writing its stdout to
+// w, or to os.Stderr if w is nil
+func docker(ctx context.Context, w io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = w
+	if w == nil {
+		cmd.Stdout = os.Stderr
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// entriesSha256 returns hex-encoded SHA-256 of the names, modes and content
+// of the entries
+func entriesSha256(entries []zipEntry) (string, error) {
+	h := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\x00%o\x00", e.name, e.mode)
+		f, err := os.Open(e.path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(dst, src string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+func initCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	registerLogFlags(fs)
+	dir := fs.String("dir", ".", "`directory` to create package in")
+	module := fs.String("module", "", "module `path` for go.mod, if it has to be created (defaults to function name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s init [flags] aws-lambda-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Creates a minimal main package for the Lambda, which passes this program\n"+
+			"safety checks; creates go.mod too, if directory is not in a module yet.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("name must be set"))
+	}
+	shortName := name[strings.LastIndexByte(name, ':')+1:]
+	if err := os.MkdirAll(*dir, 0777); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := mainTemplate.Execute(&buf, shortName); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	mainFile := filepath.Join(*dir, "main.go")
+	f, err := os.OpenFile(mainFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(src); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	slog.Info("created " + mainFile)
+	goCmd := func(args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "go", args...)
+		cmd.Dir = *dir
+		cmd.Stderr = os.Stderr
+		return cmd
+	}
+	out, err := goCmd("env", "GOMOD").Output()
+	if err != nil {
+		return err
+	}
+	if gomod := strings.TrimSpace(string(out)); gomod == "" || gomod == os.DevNull {
+		if *module == "" {
+			*module = shortName
+		}
+		if err := goCmd("mod", "init", *module).Run(); err != nil {
+			return fmt.Errorf("go mod init: %w", err)
+		}
+	}
+	if err := goCmd("mod", "tidy").Run(); err != nil {
+		return fmt.Errorf("go mod tidy: %w", err)
+	}
+	return nil
+}
+
+var mainTemplate = template.Must(template.New("main.go").Parse(`// Command {{.}} implements {{.}} AWS Lambda.
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() { lambda.Start(handler) }
+
+func handler(ctx context.Context, event json.RawMessage) (string, error) {
+	return "ok", nil
+}
+`))
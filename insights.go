@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/smithy-go"
+)
+
+// insightsAccounts are the accounts publishing the Lambda Insights extension
+// layer in the regions where it is not the default one, see
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/Lambda-Insights-extension-versions.html
+var insightsAccounts = map[string]string{
+	"af-south-1": "012438385374",
+	"ap-east-1":  "519774774795",
+	"eu-south-1": "339249233099",
+	"me-south-1": "285320876703",
+}
+
+// insightsPolicy is the managed policy execution role of the function needs
+// for the Lambda Insights extension to send its metrics
+const insightsPolicy = "arn:aws:iam::aws:policy/CloudWatchLambdaInsightsExecutionRolePolicy"
+
+// insightsLayer returns ARN (without version) of the Lambda Insights
+// extension layer for the region and Go arch
+func insightsLayer(region, arch string) (string, error) {
+	if strings.HasPrefix(region, "cn-") || strings.HasPrefix(region, "us-gov-") {
+		return "", fmt.Errorf("Lambda Insights layer is not known for the %s region", region)
+	}
+	account, ok := insightsAccounts[region]
+	if !ok {
+		account = "580247275435"
+	}
+	name := "LambdaInsightsExtension"
+	if arch == goArm64 {
+		name += "-Arm64"
+	}
+	return "arn:aws:lambda:" + region + ":" + account + ":layer:" + name, nil
+}
+
+// enableInsights attaches the latest version of the Lambda Insights extension
+// layer to the function, replacing the version it already has, and makes sure
+// the function execution role has the policy the extension needs
+func (t *target) enableInsights(ctx context.Context, args *runArgs) error {
+	if t.imageRepo != "" {
+		return errors.New("container image must include the Lambda Insights extension itself")
+	}
+	layer, err := insightsLayer(t.awsCfg.Region, t.arch)
+	if err != nil {
+		return err
+	}
+	// of the other architecture too, in case it is switched
+	other, _ := insightsLayer(t.awsCfg.Region, map[string]string{goArm64: goAmd64, goAmd64: goArm64}[t.arch])
+	var layers []string
+	var current int64
+	for _, l := range t.cfg.Layers {
+		arn := aws.ToString(l.Arn)
+		switch {
+		case strings.HasPrefix(arn, layer+":"):
+			current, _ = strconv.ParseInt(arn[len(layer)+1:], 10, 64)
+		case strings.HasPrefix(arn, other+":"):
+		default:
+			layers = append(layers, arn)
+		}
+	}
+	latest, err := latestLayerVersion(ctx, t.svc, layer, current)
+	if err != nil {
+		return err
+	}
+	if err := t.ensureRolePolicy(ctx, args, aws.ToString(t.cfg.Role), insightsPolicy); err != nil {
+		return err
+	}
+	if latest == layer+":"+strconv.FormatInt(current, 10) && len(layers)+1 == len(t.cfg.Layers) {
+		return nil
+	}
+	if args.dryRun {
+		t.logf("dry run, would attach layer %s", latest)
+		return nil
+	}
+	t.logf("attaching layer %s", latest)
+	return t.updateConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{Layers: append(layers, latest)})
+}
+
+// latestLayerVersion returns ARN of the latest version of the public layer
+// from another account, probing versions one by one starting from the given
+// one, as ListLayerVersions only lists layers of the caller's account
+func latestLayerVersion(ctx context.Context, svc *lambda.Client, layer string, from int64) (string, error) {
+	var latest string
+	for v, misses := max(from, 1), 0; misses < 3 && v < max(from, 1)+100; v++ {
+		out, err := svc.GetLayerVersion(ctx, &lambda.GetLayerVersionInput{LayerName: &layer, VersionNumber: &v})
+		var apiErr smithy.APIError
+		switch {
+		case errors.As(err, &apiErr) && (apiErr.ErrorCode() == "ResourceNotFoundException" ||
+			apiErr.ErrorCode() == "AccessDeniedException"):
+			// versions that do not exist are reported as not accessible
+			if latest != "" {
+				misses++
+			}
+		case err != nil:
+			return "", fmt.Errorf("GetLayerVersion: %w", err)
+		default:
+			latest, misses = aws.ToString(out.LayerVersionArn), 0
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no versions of the layer %s found", layer)
+	}
+	return latest, nil
+}
+
+// ensureRolePolicy attaches the managed policy to the IAM role, unless the
+// role already has it
+func (t *target) ensureRolePolicy(ctx context.Context, args *runArgs, roleArn, policy string) error {
+	role := roleArn[strings.LastIndexByte(roleArn, '/')+1:]
+	attached, err := t.attachedPolicies(ctx, role)
+	if err != nil {
+		return err
+	}
+	for _, p := range attached {
+		if p == policy {
+			return nil
+		}
+	}
+	if args.dryRun {
+		t.logf("dry run, would attach policy %s to role %s", policy, role)
+		return nil
+	}
+	t.logf("attaching policy %s to role %s", policy, role)
+	if _, err := callAPI(ctx, t.awsCfg, "iam", "us-east-1", "https://iam.amazonaws.com/", url.Values{
+		"Action":    {"AttachRolePolicy"},
+		"RoleName":  {role},
+		"PolicyArn": {policy},
+		"Version":   {"2010-05-08"},
+	}.Encode()); err != nil {
+		return fmt.Errorf("AttachRolePolicy: %w", err)
+	}
+	return nil
+}
+
+// attachedPolicies returns ARNs of the managed policies attached to the role
+func (t *target) attachedPolicies(ctx context.Context, role string) ([]string, error) {
+	var policies []string
+	var marker string
+	for {
+		form := url.Values{"Action": {"ListAttachedRolePolicies"}, "RoleName": {role}, "Version": {"2010-05-08"}}
+		if marker != "" {
+			form.Set("Marker", marker)
+		}
+		body, err := callAPI(ctx, t.awsCfg, "iam", "us-east-1", "https://iam.amazonaws.com/", form.Encode())
+		if err != nil {
+			return nil, fmt.Errorf("ListAttachedRolePolicies: %w", err)
+		}
+		var out struct {
+			Policies    []string `xml:"ListAttachedRolePoliciesResult>AttachedPolicies>member>PolicyArn"`
+			IsTruncated bool     `xml:"ListAttachedRolePoliciesResult>IsTruncated"`
+			Marker      string   `xml:"ListAttachedRolePoliciesResult>Marker"`
+		}
+		if err := xml.Unmarshal(body, &out); err != nil {
+			return nil, fmt.Errorf("ListAttachedRolePolicies: %w", err)
+		}
+		policies = append(policies, out.Policies...)
+		if !out.IsTruncated {
+			return policies, nil
+		}
+		marker = out.Marker
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+func invokeCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("invoke", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	payloadFile := fs.String("payload", "", "`file` with JSON payload to send (empty JSON object is sent by default)")
+	qualifier := fs.String("qualifier", "", "function `version or alias` to invoke")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s invoke [flags] aws-lambda-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Invokes function, printing its response to stdout, and the tail of its logs\n"+
+			"to stderr. Exits with non-zero code if the function failed.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("name must be set"))
+	}
+	payload, err := readPayload(*payloadFile)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	return invoke(ctx, lambda.NewFromConfig(cfg), name, *qualifier, payload)
+}
+
+func readPayload(name string) ([]byte, error) {
+	if name == "" {
+		return []byte("{}"), nil
+	}
+	return os.ReadFile(name)
+}
+
+// invoke synchronously invokes function, printing its response to stdout and
+// the tail of its log to stderr. It returns an error if the function failed.
+func invoke(ctx context.Context, svc *lambda.Client, name, qualifier string, payload []byte) error {
+	in := &lambda.InvokeInput{
+		FunctionName: &name,
+		Payload:      payload,
+		LogType:      types.LogTypeTail,
+	}
+	if qualifier != "" {
+		in.Qualifier = &qualifier
+	}
+	out, err := svc.Invoke(ctx, in)
+	if err != nil {
+		return fmt.Errorf("Invoke: %w", err)
+	}
+	if out.LogResult != nil {
+		if b, err := base64.StdEncoding.DecodeString(*out.LogResult); err == nil {
+			fmt.Fprintf(os.Stderr, "log tail:\n%s\n", strings.TrimRight(string(b), "\n"))
+		}
+	}
+	os.Stdout.Write(out.Payload)
+	if len(out.Payload) != 0 && out.Payload[len(out.Payload)-1] != '\n' {
+		os.Stdout.WriteString("\n")
+	}
+	if out.FunctionError != nil {
+		return fmt.Errorf("function failed (version %s): %s", aws.ToString(out.ExecutedVersion), *out.FunctionError)
+	}
+	if out.StatusCode < 200 || out.StatusCode > 299 {
+		return fmt.Errorf("unexpected invocation status code %d", out.StatusCode)
+	}
+	return nil
+}
+
+// smokeTest waits up to timeout for the published version to become active,
+// then invokes it with the payload
+func (t *target) smokeTest(ctx context.Context, version string, payload []byte, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	w := lambda.NewPublishedVersionActiveWaiter(t.svc)
+	if err := w.Wait(waitCtx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &t.name,
+		Qualifier:    &version,
+	}, maxWait(waitCtx)); err != nil {
+		return fmt.Errorf("waiting for version %s to become active: %w", version, err)
+	}
+	t.logf("invoking version %s", version)
+	if err := invoke(ctx, t.svc, t.name, version, payload); err != nil {
+		return fmt.Errorf("smoke test: %w", err)
+	}
+	t.logf("smoke test passed")
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+func layerCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("layer", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	dir := fs.String("dir", "", "`directory` to put into the layer")
+	pkg := fs.String("build", "", "build Go main `package` and put its binary into the layer's bin directory")
+	arch := goArm64
+	fs.Func("arch", "`architecture` to build -build package for: arm64 (default) or x86_64", func(s string) error {
+		var err error
+		arch, err = parseArch(s)
+		return err
+	})
+	description := fs.String("description", "", "layer version `description`")
+	attach := fs.String("attach", "", "attach published layer version to this `function`")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s layer [flags] layer-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Publishes a new layer version with the -dir content, and/or binary built\n"+
+			"from the -build package. With -attach, function is updated to use the new\n"+
+			"layer version, replacing older versions of the same layer.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("layer name must be set"))
+	}
+	if *dir == "" && *pkg == "" {
+		return withExitCode(exitInvalid, errors.New("either -dir or -build must be set"))
+	}
+	var entries []zipEntry
+	if *dir != "" {
+		var err error
+		if entries, err = dirEntries(*dir, ""); err != nil {
+			return err
+		}
+	}
+	compatible := []types.Architecture{types.ArchitectureArm64, types.ArchitectureX8664}
+	if *pkg != "" {
+		tdir, err := os.MkdirTemp("", "publish-go-lambda-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tdir)
+		binPath := filepath.Join(tdir, "main")
+		if err := buildBinary(ctx, *pkg, &buildOptions{arch: arch}, binPath); err != nil {
+			return err
+		}
+		pkgDir, err := filepath.Abs(*pkg)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, zipEntry{name: path.Join("bin", filepath.Base(pkgDir)), path: binPath, mode: 0775})
+		compatible = []types.Architecture{lambdaArch(arch)}
+	}
+	zipData, err := zipFiles(entries)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	svc := lambda.NewFromConfig(cfg)
+	out, err := svc.PublishLayerVersion(ctx, &lambda.PublishLayerVersionInput{
+		LayerName:               &name,
+		Content:                 &types.LayerVersionContentInput{ZipFile: zipData},
+		Description:             description,
+		CompatibleArchitectures: compatible,
+		CompatibleRuntimes:      []types.Runtime{types.RuntimeProvidedal2, types.RuntimeProvidedal2023},
+	})
+	if err != nil {
+		return fmt.Errorf("PublishLayerVersion: %w", err)
+	}
+	slog.Info("published " + aws.ToString(out.LayerVersionArn))
+	if *attach == "" {
+		return nil
+	}
+	if err := attachLayer(ctx, svc, *attach, aws.ToString(out.LayerArn), aws.ToString(out.LayerVersionArn)); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("function %s now uses %s", *attach, aws.ToString(out.LayerVersionArn)))
+	return nil
+}
+
+// attachLayer updates function configuration to use the layer version,
+// replacing other versions of the same layer, if function has any
+func attachLayer(ctx context.Context, svc *lambda.Client, function, layerArn, versionArn string) error {
+	fn, err := svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{FunctionName: &function})
+	if err != nil {
+		return fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	if _, err := svc.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: &function,
+		Layers:       withLayer(fn.Layers, layerArn, versionArn),
+		RevisionId:   fn.RevisionId,
+	}); err != nil {
+		return fmt.Errorf("UpdateFunctionConfiguration: %w", err)
+	}
+	return nil
+}
+
+// withLayer returns ARNs of the layers with the layer version added,
+// replacing other versions of the same layer
+func withLayer(current []types.Layer, layerArn, versionArn string) []string {
+	var layers []string
+	var replaced bool
+	for _, l := range current {
+		arn := aws.ToString(l.Arn)
+		if strings.HasPrefix(arn, layerArn+":") {
+			if !replaced {
+				layers = append(layers, versionArn)
+			}
+			replaced = true
+			continue
+		}
+		layers = append(layers, arn)
+	}
+	if !replaced {
+		layers = append(layers, versionArn)
+	}
+	return layers
+}
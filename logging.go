@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// logLevel is the minimal level of messages to log, set with -log-level flag
+var logLevel slog.LevelVar
+
+// setLogFormat makes default logger write to stderr in the given format:
+// text or json. Text format omits time, as the program is mostly run
+// interactively or in CI, which adds its own timestamps.
+func setLogFormat(format string) error {
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: &logLevel,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel})
+	default:
+		return errors.New("must be either text or json")
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// registerLogFlags adds -log-format, -log-level, -q, -v, and -vv flags to fs;
+// they take effect as soon as they are parsed
+func registerLogFlags(fs *flag.FlagSet) {
+	fs.Func("log-format", "log `format`: text or json (default text)", setLogFormat)
+	fs.Func("log-level", "minimal `level` of messages to log: debug, info, warn, or error (default info)",
+		func(s string) error { return logLevel.UnmarshalText([]byte(s)) })
+	fs.BoolFunc("q", "quiet: only log errors", func(s string) error {
+		quiet, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		if quiet {
+			logLevel.Set(slog.LevelError)
+		} else {
+			logLevel.Set(slog.LevelInfo)
+		}
+		return nil
+	})
+	fs.BoolFunc("v", "verbose: log debug messages, including each step taken, and AWS SDK retries",
+		func(string) error { return setVerbosity(1) })
+	fs.BoolFunc("vv", "very verbose: as -v, plus log AWS API requests and responses, with credentials redacted",
+		func(string) error { return setVerbosity(2) })
+}
+
+func setVerbosity(n int) error {
+	verbosity = max(verbosity, n)
+	logLevel.Set(slog.LevelDebug)
+	return nil
+}
+
+// fatal logs err and exits with the code matching it
+func fatal(err error) {
+	if !errors.Is(err, errNothingToDeploy) {
+		slog.Error(err.Error())
+	}
+	os.Exit(exitCode(err))
+}
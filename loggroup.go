@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// logRetentionDays are the retention periods CloudWatch Logs supports
+var logRetentionDays = []int32{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192,
+	2557, 2922, 3288, 3653}
+
+// ensureLogGroup creates the function log group if it does not exist, and
+// sets its retention to the given number of days, so that function logs do
+// not accumulate forever, as they do in the log group Lambda creates
+func (t *target) ensureLogGroup(ctx context.Context, args *runArgs, days int32) error {
+	group := t.logGroup()
+	svc := cloudwatchlogs.NewFromConfig(t.awsCfg)
+	out, err := svc.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: &group})
+	if err != nil {
+		return fmt.Errorf("DescribeLogGroups: %w", err)
+	}
+	i := slices.IndexFunc(out.LogGroups, func(g cwltypes.LogGroup) bool { return aws.ToString(g.LogGroupName) == group })
+	if i != -1 && aws.ToInt32(out.LogGroups[i].RetentionInDays) == days {
+		return nil
+	}
+	if args.dryRun {
+		if i == -1 {
+			t.logf("dry run, would create log group %s with %d days retention", group, days)
+		} else {
+			t.logf("dry run, would set log group %s retention to %d days", group, days)
+		}
+		return nil
+	}
+	if i == -1 {
+		_, err := svc.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{LogGroupName: &group})
+		var exists *cwltypes.ResourceAlreadyExistsException
+		if err != nil && !errors.As(err, &exists) {
+			return fmt.Errorf("CreateLogGroup: %w", err)
+		}
+		t.logf("created log group %s", group)
+	}
+	if _, err := svc.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+		LogGroupName:    &group,
+		RetentionInDays: &days,
+	}); err != nil {
+		return fmt.Errorf("PutRetentionPolicy: %w", err)
+	}
+	t.logf("log group %s retention set to %d days", group, days)
+	return nil
+}
@@ -1,77 +1,1148 @@
 // Command publish-go-lambda builds Go source in the current directory and
 // publishes it as an existing AWS Lambda (either Go 1.x runtime or custom
-// Amazon Linux 2 runtime).
+// Amazon Linux 2 / Amazon Linux 2023 runtime).
 package main
 
 import (
 	"archive/zip"
 	"bytes"
-	"compress/flate"
 	"context"
+	"crypto"
+	"debug/buildinfo"
 	"errors"
 	"flag"
 	"fmt"
 	"go/parser"
 	"go/token"
 	"io"
-	"io/ioutil"
-	"log"
+	"io/fs"
+	"log/slog"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 func main() {
-	log.SetFlags(0)
-	var relaxedChecks bool
-	flag.BoolVar(&relaxedChecks, "f", relaxedChecks, "skip some safety checks")
+	setLogFormat("text")
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+			if err := cmd.run(ctx, os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+	var args runArgs
+	flag.BoolVar(&args.relaxedChecks, "f", args.relaxedChecks, "skip some safety checks")
+	flag.BoolVar(&args.dryRun, "dry-run", args.dryRun, "build and validate, but don't update the function;"+
+		" print what would be uploaded instead")
+	flag.StringVar(&args.output, "o", args.output, "write deployment package to this `file` instead of updating the function")
+	flag.StringVar(&args.binPath, "bin", args.binPath, "skip build, deploy this pre-built linux `binary`")
+	flag.StringVar(&args.zipPath, "zip", args.zipPath, "skip build, deploy binary from this pre-built zip `file`")
+	flag.BoolVar(&args.watch, "watch", args.watch, "watch package sources and rebuild/publish on each change")
+	flag.StringVar(&args.configFile, "config", args.configFile, "publish functions listed in this config `file`")
+	flag.StringVar(&args.changedSince, "changed-since", args.changedSince, "only publish if package or its local"+
+		" dependencies changed since this git `ref`")
+	flag.StringVar(&args.alias, "alias", args.alias, "point this `alias` to the published version, creating it if needed")
+	flag.Float64Var(&args.canaryWeight, "canary", args.canaryWeight, "canary rollout: route this `percent` of -alias"+
+		" traffic to the new version for -bake time, then either promote it, or roll back")
+	flag.DurationVar(&args.bakeTime, "bake", 10*time.Minute, "canary bake `time`")
+	flag.IntVar(&args.canaryMaxErrors, "canary-max-errors", args.canaryMaxErrors, "roll canary back if the new version"+
+		" reports more than this `number` of errors")
+	flag.DurationVar(&args.canaryMaxDuration, "canary-max-duration", args.canaryMaxDuration, "roll canary back if the new"+
+		" version average invocation duration gets above this `value` (0 to disable)")
+	flag.BoolVar(&args.create, "create", args.create, "create function if it does not exist (requires -role)")
+	flag.StringVar(&args.role, "role", args.role, "execution role `ARN` for the function created with -create")
+	flag.Func("arch", "`architecture` to build for: arm64 or x86_64; existing function is switched to it if needed"+
+		" (default is the function's current architecture, or arm64 for the function created with -create)", func(s string) error {
+		var err error
+		args.arch, err = parseArch(s)
+		return err
+	})
+	flag.Func("memory", "memory `size` in MB of the function, set before publishing the code", func(s string) error {
+		n, err := strconv.ParseInt(s, 10, 32)
+		args.memory = int32(n)
+		return err
+	})
+	flag.Func("ephemeral-storage", "`size` in MB of the function /tmp directory, set before publishing the code",
+		func(s string) error {
+			n, err := strconv.ParseInt(s, 10, 32)
+			args.ephemeralStorage = int32(n)
+			return err
+		})
+	flag.DurationVar(&args.functionTimeout, "timeout-config", args.functionTimeout, "`timeout` of the function,"+
+		" set before publishing the code")
+	flag.StringVar(&args.baseImage, "base-image", "public.ecr.aws/lambda/provided:al2023", "base `image`"+
+		" for Image type packaged Lambdas")
+	flag.Func("tags", "comma-separated `list` of build tags", func(s string) error {
+		args.tags = splitList(s)
+		return nil
+	})
+	flag.Func("X", "set string variable value in the binary: `pkg.Var=value`, same as go build"+
+		" -ldflags=-X; can be repeated", func(s string) error {
+		if name, _, ok := strings.Cut(s, "="); !ok || !strings.Contains(name, ".") {
+			return errors.New("value must be in pkg.Var=value form")
+		}
+		args.vars = append(args.vars, s)
+		return nil
+	})
+	args.stampVars, _ = parseStampVars(defaultStampVars)
+	flag.Func("stamp-vars", "comma-separated `list` of key=pkg.Var pairs naming variables to set to the git"+
+		" describe output (version key), commit SHA (commit), and build time (time); empty to disable"+
+		" (default "+defaultStampVars+")", func(s string) error {
+		var err error
+		args.stampVars, err = parseStampVars(s)
+		return err
+	})
+	flag.BoolVar(&args.rpc, "rpc", args.rpc, "don't build with lambda.norpc tag for provided.al2 and"+
+		" provided.al2023 runtimes")
+	flag.BoolVar(&args.cgo, "cgo", args.cgo, "build with cgo enabled, cross-compiling C code with zig"+
+		" for the glibc of Amazon Linux 2, unless -cc is set")
+	flag.StringVar(&args.toolchain, "toolchain", args.toolchain, "build with this Go `version`, like go1.22.5,"+
+		" downloading it if needed")
+	flag.StringVar(&args.pgo, "pgo", "auto", "profile-guided optimization profile: `file` path, s3://bucket/key URL,"+
+		" auto (default.pgo in the package directory, if exists), or off")
+	flag.StringVar(&args.compiler, "compiler", "gc", "`compiler` to build with: gc (go build) or tinygo")
+	flag.BoolVar(&args.buildInDocker, "build-in-docker", args.buildInDocker, "build inside a container from"+
+		" -build-image, mounting the module and the host module cache")
+	flag.StringVar(&args.buildImage, "build-image", defaultBuildImage, "`image` for -build-in-docker builds")
+	flag.StringVar(&args.cc, "cc", args.cc, "C compiler `command` for -cgo builds, instead of zig")
+	flag.BoolVar(&args.test, "test", args.test, "run go test ./... in the package directory before building,"+
+		" and stop if tests fail")
+	flag.BoolVar(&args.lint, "lint", args.lint, "run go vet (and staticcheck, if installed) before building,"+
+		" and stop if they report issues")
+	flag.Func("vulncheck", "run govulncheck before building; `mode` is either fail (stop on reachable"+
+		" vulnerabilities) or warn (only report them)", func(s string) error {
+		if s != "fail" && s != "warn" {
+			return errors.New("must be either fail or warn")
+		}
+		args.vulncheck = s
+		return nil
+	})
+	flag.BoolVar(&args.generate, "generate", args.generate, "run go generate ./... in the package directory before building")
+	flag.StringVar(&args.buildCmd, "build-cmd", args.buildCmd, "build binary with this shell `command`"+
+		" instead of go build; command gets GOOS, GOARCH, OUTPUT, BUILD_TAGS, and LDFLAGS environment variables,"+
+		" and must save the binary to $OUTPUT")
+	flag.Var(&args.maxSize, "max-size", "fail if the zipped package is bigger than this `size`, like 20MB")
+	flag.Var(&args.maxUnzippedSize, "max-unzipped-size", "fail if the unzipped package is bigger than this `size`")
+	flag.BoolVar(&args.whyBig, "why-big", args.whyBig, "build, print the top contributors to the binary size by"+
+		" package, with changes since the previous -why-big build, and exit without publishing")
+	flag.Var(&args.upx, "upx", "compress binary with UPX, optionally with the given `level` (1-9 or best);"+
+		" makes cold starts slower")
+	flag.Func("compression", "compress packaged files this `way`: fast, best, store (no compression), or auto"+
+		" (chosen for each file by compressing its samples) (default best)", func(s string) error {
+		var err error
+		args.compression, err = parseCompression(s)
+		return err
+	})
+	flag.Func("include", "put this file or directory into the package too, optionally under the given name:"+
+		" `path[:zip/path]`; can be repeated", func(s string) error {
+		args.includes = append(args.includes, s)
+		return nil
+	})
+	flag.Func("helper", "also build this main package and put its binary into the package, optionally"+
+		" under the given name: `pkg[:name]`; can be repeated", func(s string) error {
+		args.helpers = append(args.helpers, s)
+		return nil
+	})
+	flag.Func("extension", "build this main package as a Lambda extension, optionally under the given"+
+		" name: `pkg[:name]`; can be repeated", func(s string) error {
+		args.extensions = append(args.extensions, s)
+		return nil
+	})
+	flag.StringVar(&args.extensionsLayer, "extensions-layer", args.extensionsLayer, "`name` of the layer to"+
+		" publish -extension binaries to (defaults to function name with the -extensions suffix)")
+	flag.Func("smoke", "after publishing, invoke the new version with JSON payload from this `file`,"+
+		" failing if the function fails", func(s string) error {
+		var err error
+		args.smokePayload, err = os.ReadFile(s)
+		return err
+	})
+	flag.Func("env-file", "set function environment variables from this .env `file` before publishing,"+
+		" keeping other variables the function has", func(s string) error {
+		var err error
+		args.env, err = parseEnvFile(s)
+		return err
+	})
+	flag.Func("env-check", "before publishing, compare function environment variables with the ones from this .env `file`,"+
+		" failing if they differ; when run interactively, ask whether to publish anyway", func(s string) error {
+		var err error
+		args.envCheck, err = parseEnvFile(s)
+		return err
+	})
+	flag.Func("reserved-concurrency", "after publishing, set reserved concurrency of the function to this `number`,"+
+		" 0 removes the reservation", func(s string) error {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err == nil && n < 0 {
+			err = errors.New("must not be negative")
+		}
+		args.reservedConcurrency = aws.Int32(int32(n))
+		return err
+	})
+	flag.Func("provisioned-concurrency", "after publishing, configure this `number` of provisioned concurrent executions"+
+		" for the new version and wait for them before pointing -alias to it, releasing ones of the retired versions", func(s string) error {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err == nil && n <= 0 {
+			err = errors.New("must be positive")
+		}
+		args.provisionedConcurrency = int32(n)
+		return err
+	})
+	flag.Func("tracing", "set X-Ray tracing `mode` of the function: active or passthrough", func(s string) error {
+		var err error
+		args.tracing, err = parseTracingMode(s)
+		return err
+	})
+	flag.BoolVar(&args.insights, "insights", args.insights, "attach the latest Lambda Insights extension layer"+
+		" to the function, and the policy it needs to the function role")
+	flag.Func("adot", "attach the AWS Distro for OpenTelemetry collector layer of this `release`, like 0.102.1,"+
+		" to the function, enabling Active tracing", func(s string) error {
+		if !adotReleaseRe.MatchString(s) {
+			return errors.New("release must be in the X.Y.Z form")
+		}
+		args.adot = s
+		return nil
+	})
+	flag.Func("runtime-update", "set runtime management `mode` of the function: auto, function-update,"+
+		" or manual:ARN to pin the runtime version", func(s string) error {
+		var err error
+		args.runtimeUpdate, err = parseRuntimeUpdate(s)
+		return err
+	})
+	flag.Func("log-retention", "create function log group if it does not exist, and set its retention"+
+		" to this number of `days`", func(s string) error {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err == nil && !slices.Contains(logRetentionDays, int32(n)) {
+			err = fmt.Errorf("unsupported retention, want one of %v", logRetentionDays)
+		}
+		args.logRetention = int32(n)
+		return err
+	})
+	flag.Func("function-url", "make sure function (or -alias) has a Function URL with this `auth` type,"+
+		" AWS_IAM or NONE, and print it", func(s string) error {
+		switch auth := types.FunctionUrlAuthType(strings.ToUpper(s)); auth {
+		case types.FunctionUrlAuthTypeAwsIam, types.FunctionUrlAuthTypeNone:
+			args.functionURL = auth
+			return nil
+		}
+		return fmt.Errorf("unsupported auth type %q, want either %s or %s", s,
+			types.FunctionUrlAuthTypeAwsIam, types.FunctionUrlAuthTypeNone)
+	})
+	flag.BoolVar(&args.rollbackOnFailure, "rollback-on-failure", args.rollbackOnFailure, "if -smoke test fails,"+
+		" re-publish the code function had before")
+	flag.BoolVar(&args.tail, "tail", args.tail, "stream function logs after publishing, until interrupted")
+	flag.StringVar(&args.releaseTag, "release-tag", args.releaseTag, "only publish functions with the"+
+		" -protected-tag from git HEAD having an annotated tag matching this `pattern`, like v*")
+	flag.StringVar(&args.protectedTag, "protected-tag", "environment=production", "AWS tag `key=value`"+
+		" marking functions protected by -release-tag")
+	flag.StringVar(&args.tagPrefix, "tag-prefix", "deploy:", "after publishing, tag function with the version"+
+		" (`prefix`version), git commit (sha), branch (branch), deployer identity (by), and time (at);"+
+		" empty to disable")
+	flag.Func("audit", "after publishing, write deploy record to this `location`: either s3://bucket/prefix/"+
+		" or dynamodb:table", func(s string) error {
+		var err error
+		args.audit, err = parseAuditLog(s)
+		return err
+	})
+	flag.Func("signing-location", "if function has a code signing configuration, sign the package with AWS Signer,"+
+		" uploading it to this s3://bucket/prefix/ `URL` in the versioned bucket", func(s string) error {
+		var err error
+		args.signingLocation, err = parseS3Location(s)
+		return err
+	})
+	flag.Func("upload-location", "upload the package to this s3://bucket/prefix/ `URL` for Lambda to take it from,"+
+		" instead of sending it within the request", func(s string) error {
+		var err error
+		args.uploadLocation, err = parseS3Location(s)
+		return err
+	})
+	flag.Func("sbom", "after publishing, write CycloneDX SBOM of the build to this s3://bucket/prefix/ `URL`,"+
+		" see sbom subcommand", func(s string) error {
+		var err error
+		args.sbom, err = parseVersionStore(s)
+		return err
+	})
+	flag.Func("provenance", "after publishing, write signed SLSA provenance of the build to this"+
+		" s3://bucket/prefix/ `URL`, see verify subcommand", func(s string) error {
+		var err error
+		args.provenance, err = parseVersionStore(s)
+		return err
+	})
+	flag.Func("provenance-key", "PEM-encoded PKCS #8 Ed25519 or ECDSA private key `file` to sign -provenance with",
+		func(s string) error {
+			var err error
+			args.provenanceKey, err = loadSigningKey(s)
+			return err
+		})
+	flag.Func("cosign", "sign the package with cosign, and, after publishing, write it with the signature bundle"+
+		" to this s3://bucket/prefix/ `URL`", func(s string) error {
+		var err error
+		args.cosign, err = parseVersionStore(s)
+		return err
+	})
+	flag.StringVar(&args.cosignKey, "cosign-key", args.cosignKey, "`key` to sign the package with for -cosign:"+
+		" anything cosign accepts as --key, like a key file or KMS URI; empty for keyless signing")
+	flag.IntVar(&args.pruneKeep, "prune-keep", args.pruneKeep, "if account code storage gets close to the quota,"+
+		" delete old versions after publishing, keeping this `number` of the most recent ones, see prune subcommand")
+	flag.StringVar(&args.eventBus, "event-bus", args.eventBus, "after publishing, send publish-go-lambda.Deployed"+
+		" event to this EventBridge bus `name or ARN`")
+	flag.StringVar(&args.notifyURL, "notify-url", args.notifyURL, "once publishing completes, either"+
+		" successfully or not, post JSON payload describing the outcome to this webhook `URL`")
+	flag.Func("notify-template", "text/template `file` to render -notify-url payload with", func(s string) error {
+		var err error
+		args.notifyTemplate, err = loadNotifyTemplate(s)
+		return err
+	})
+	flag.DurationVar(&args.timeout, "timeout", 5*time.Minute, "limit on the `duration` of publishing to each target,"+
+		" including waiting for the updates to complete")
+	flag.DurationVar(&args.buildTimeout, "build-timeout", 0, "limit on the `duration` of the build (default no limit)")
+	flag.BoolVar(&args.migrateRuntime, "migrate-runtime", args.migrateRuntime, "migrate function from the deprecated "+
+		string(types.RuntimeGo1x)+" runtime to "+string(types.RuntimeProvidedal2023))
+	flag.BoolVar(&args.strictReliability, "strict-reliability", args.strictReliability, "fail if function AWS services"+
+		" invoke asynchronously has neither a dead-letter queue, nor an on-failure destination")
+	flag.BoolVar(&args.fixHandler, "fix-handler", args.fixHandler, "update function handler to match the binary name, if it does not")
+	flag.BoolVar(&args.failDeprecated, "fail-deprecated", args.failDeprecated, "fail with exit code 6 if function uses a deprecated runtime")
+	flag.StringVar(&args.qualifier, "qualifier", "", "check runtime, architecture, and handler of the function against this"+
+		" `alias or version` instead of $LATEST")
+	flag.BoolVar(&args.wait, "wait", args.wait, "wait for the code update to complete, and fail if Lambda reports it failed")
+	flag.BoolVar(&args.detailedExitCode, "detailed-exitcode", args.detailedExitCode,
+		"exit with code 5 if there is nothing to deploy, because deployed code is already up to date")
+	flag.BoolVar(&args.json, "json", args.json, "print JSON document describing the outcome to stdout;"+
+		" logs still go to stderr")
+	flag.Func("regions", "comma-separated `list` of regions to publish to", func(s string) error {
+		args.regions = splitList(s)
+		return nil
+	})
+	flag.Func("roles", "comma-separated `list` of IAM role ARNs to assume, publishing to each role's account", func(s string) error {
+		args.roles = splitList(s)
+		return nil
+	})
+	registerLogFlags(flag.CommandLine)
+	registerAWSFlags(flag.CommandLine)
 	flag.Parse()
+	args.dir = "."
+	if args.configFile == "" {
+		args.name = flag.Arg(0)
+	}
+	if err := args.validate(); err != nil {
+		fatal(withExitCode(exitInvalid, err))
+	}
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
-	if err := run(ctx, flag.Arg(0), relaxedChecks); err != nil {
-		log.Fatal(err)
+	var err error
+	switch {
+	case args.configFile != "":
+		err = runConfig(ctx, args, flag.Args())
+	case args.watch:
+		// no need to track build results here: run skips the upload if
+		// package is the same as the deployed code
+		err = watch(ctx, args.dir, args.tags, func() error { return run(ctx, args) })
+	default:
+		err = run(ctx, args)
+	}
+	if err != nil {
+		fatal(err)
 	}
 }
 
-func run(ctx context.Context, name string, relaxedChecks bool) error {
-	if name == "" {
+type runArgs struct {
+	name                   string
+	dir                    string   // directory with the main package
+	tags                   []string // build tags
+	relaxedChecks          bool
+	dryRun                 bool
+	output                 string // if set, save zip to this file instead of upload
+	binPath                string // pre-built binary to use instead of building one
+	zipPath                string // pre-built zip to take binary from
+	watch                  bool
+	configFile             string
+	changedSince           string        // git ref
+	alias                  string        // point this alias to the published version
+	canaryWeight           float64       // percent of alias traffic to route to the new version during canary
+	bakeTime               time.Duration // canary duration
+	canaryMaxErrors        int           // canary fails if it gets more errors than this
+	canaryMaxDuration      time.Duration // canary fails if average duration is higher than this
+	regions                []string      // publish to these regions instead of the default one
+	roles                  []string      // publish to accounts of these roles, assuming each
+	tail                   bool          // stream function logs after publishing
+	smokePayload           []byte        // if set, invoke published version with it
+	rollbackOnFailure      bool          // restore previous code if smoke test fails
+	create                 bool          // create function if it does not exist
+	role                   string        // execution role for the created function
+	memory                 int32         // memory size, MB
+	functionTimeout        time.Duration
+	arch                   string                    // Go arch
+	baseImage              string                    // base image for container-packaged functions
+	includes               []string                  // extra files to package, in path[:zip/path] form
+	helpers                []string                  // extra main packages to build and package, in pkg[:name] form
+	extensions             []string                  // main packages to build as Lambda extensions, in pkg[:name] form
+	extensionsLayer        string                    // name of the layer to publish extensions to
+	upx                    upxLevel                  // UPX compression level, 0 to disable
+	rpc                    bool                      // do not add lambda.norpc build tag for provided runtimes
+	vars                   []string                  // -X linker flag values, in pkg.Var=value form
+	stampVars              map[string]string         // variables to stamp git state into, keyed by version, commit, or time
+	buildCmd               string                    // shell command to build the binary with instead of go build
+	generate               bool                      // run go generate before building
+	cgo                    bool                      // build with cgo enabled
+	cc                     string                    // C compiler for -cgo builds
+	buildImage             string                    // image for buildInDocker builds
+	buildInDocker          bool                      // build inside a container from buildImage
+	compiler               string                    // gc or tinygo
+	toolchain              string                    // Go toolchain to build with, like go1.22.5
+	pgo                    string                    // go build -pgo value: auto, off, file path, or s3:// URL
+	test                   bool                      // run tests before building
+	vulncheck              string                    // fail or warn to run govulncheck before building
+	lint                   bool                      // run go vet and staticcheck before building
+	releaseTag             string                    // pattern of git tags protected functions must be published from
+	protectedTag           string                    // key=value AWS tag of protected functions
+	tagPrefix              string                    // prefix of the deploy tags to set on the function, empty to disable
+	audit                  *auditLog                 // where to write deploy records to
+	eventBus               string                    // EventBridge bus to send deploy events to
+	notifyURL              string                    // webhook to post deploy outcome to
+	notifyTemplate         *template.Template        // webhook payload template, nil for the default one
+	json                   bool                      // print JSON result to stdout
+	detailedExitCode       bool                      // exit with exitUnchanged code if there is nothing to deploy
+	wait                   bool                      // wait for the code update to complete, reporting failures
+	timeout                time.Duration             // limit on time publishing to each target takes
+	buildTimeout           time.Duration             // limit on time the build takes, if positive
+	qualifier              string                    // alias or version to check function configuration of
+	migrateRuntime         bool                      // move go1.x functions to provided.al2023
+	failDeprecated         bool                      // fail if function uses a deprecated runtime
+	fixHandler             bool                      // update function handler to match the binary name
+	env                    map[string]string         // environment variables to set on function
+	envCheck               map[string]string         // environment variables function is expected to have, nil to skip the check
+	reservedConcurrency    *int32                    // reserved concurrency to set after publishing, 0 to remove the reservation
+	provisionedConcurrency int32                     // provisioned concurrency to configure for the new version, if positive
+	functionURL            types.FunctionUrlAuthType // auth type of the Function URL to ensure, empty to skip
+	tracing                types.TracingMode         // tracing mode to set, empty to keep the current one
+	ephemeralStorage       int32                     // size of /tmp in MB, 0 to keep the current one
+	strictReliability      bool                      // fail if async-invoked function has no failure destination
+	logRetention           int32                     // function log group retention in days, 0 to leave log group as is
+	insights               bool                      // attach the Lambda Insights extension layer
+	adot                   string                    // release of the ADOT collector layer to attach, like 0.102.1
+	runtimeUpdate          *runtimeUpdate            // runtime management configuration to set, nil to keep the current one
+	signingLocation        *s3Location               // where to sign packages with AWS Signer, set with -signing-location
+	sbom                   *versionStore             // where to write SBOMs of the published versions to
+	provenance             *versionStore             // where to write signed provenance of the published versions to
+	provenanceKey          crypto.Signer             // key to sign provenance with
+	cosign                 *versionStore             // where to write cosign-signed packages to
+	cosignKey              string                    // cosign key reference, empty for keyless signing
+	maxSize                byteSize                  // zipped package size budget, 0 for none
+	maxUnzippedSize        byteSize                  // unzipped package size budget, 0 for none
+	whyBig                 bool                      // print binary size report and exit
+	pruneKeep              int                       // versions to keep when pruning near the code storage quota, 0 to not prune
+	uploadLocation         *s3Location               // where to upload packages to for Lambda to take them from, nil to send them within requests
+	compression            compression               // how to compress packaged files, empty for best
+	codeStorage            codeStorage               // account code storage usage, shared by the functions of the config file
+}
+
+func (args *runArgs) validate() error {
+	if (args.provenance == nil) != (args.provenanceKey == nil) {
+		return errors.New("-provenance and -provenance-key flags must be used together")
+	}
+	if args.pruneKeep < 0 {
+		return errors.New("-prune-keep cannot be negative")
+	}
+	if args.configFile != "" {
+		if args.watch || args.output != "" || args.binPath != "" || args.zipPath != "" {
+			return errors.New("-config cannot be used with -watch, -o, -bin, or -zip flags")
+		}
+		return nil
+	}
+	if args.name == "" {
 		return errors.New("name must be set")
 	}
-	shortName := name[strings.LastIndexByte(name, ':')+1:]
-	if err := checkMainPackage(".", shortName, !relaxedChecks); err != nil {
+	if args.detailedExitCode && args.watch {
+		return errors.New("-detailed-exitcode cannot be used with -watch")
+	}
+	if args.migrateRuntime && args.rollbackOnFailure {
+		return errors.New("-rollback-on-failure cannot be used with -migrate-runtime: previous code cannot run on the new runtime")
+	}
+	if args.qualifier != "" && args.create {
+		return errors.New("-qualifier cannot be used with -create")
+	}
+	if args.json && (args.tail || args.output != "") {
+		return errors.New("-json cannot be used with -tail or -o flags")
+	}
+	if args.binPath != "" && args.zipPath != "" {
+		return errors.New("-bin and -zip flags are mutually exclusive")
+	}
+	if args.buildCmd != "" && (args.binPath != "" || args.zipPath != "") {
+		return errors.New("-build-cmd cannot be used with -bin or -zip flags")
+	}
+	switch args.compiler {
+	case "gc":
+	case "tinygo":
+		if args.pgo != "auto" && args.pgo != "off" {
+			return errors.New("-compiler tinygo cannot be used with -pgo")
+		}
+		if args.buildInDocker || args.cgo || args.buildCmd != "" || args.toolchain != "" {
+			return errors.New("-compiler tinygo cannot be used with -build-in-docker, -cgo, -build-cmd, or -toolchain")
+		}
+		if _, err := exec.LookPath("tinygo"); err != nil {
+			return fmt.Errorf("-compiler tinygo: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported -compiler %q, must be gc or tinygo", args.compiler)
+	}
+	if args.memory != 0 && (args.memory < 128 || args.memory > 10240) {
+		return errors.New("-memory must be between 128 and 10240 MB")
+	}
+	if args.ephemeralStorage != 0 && (args.ephemeralStorage < 512 || args.ephemeralStorage > 10240) {
+		return errors.New("-ephemeral-storage must be between 512 and 10240 MB")
+	}
+	if args.functionTimeout != 0 && (args.functionTimeout < time.Second || args.functionTimeout > 15*time.Minute ||
+		args.functionTimeout%time.Second != 0) {
+		return errors.New("-timeout-config must be a whole number of seconds, from 1s to 15m")
+	}
+	if args.toolchain != "" && !strings.HasPrefix(args.toolchain, "go1.") {
+		return fmt.Errorf("invalid -toolchain %q, want a Go version like go1.22.5", args.toolchain)
+	}
+	if !strings.Contains(args.protectedTag, "=") {
+		return errors.New("-protected-tag must be in key=value form")
+	}
+	if args.buildCmd != "" && args.buildInDocker {
+		return errors.New("-build-cmd cannot be used with -build-in-docker")
+	}
+	if args.watch && (args.binPath != "" || args.zipPath != "") {
+		return errors.New("-watch cannot be used with -bin or -zip flags")
+	}
+	if args.create && args.role == "" {
+		return errors.New("-create requires -role")
+	}
+	if args.rollbackOnFailure && args.smokePayload == nil {
+		return errors.New("-rollback-on-failure requires -smoke")
+	}
+	if args.canaryWeight != 0 && args.alias == "" {
+		return errors.New("-canary requires -alias")
+	}
+	if args.canaryWeight < 0 || args.canaryWeight >= 100 {
+		return errors.New("-canary must be in the [0, 100) range")
+	}
+	if args.canaryWeight != 0 && args.bakeTime <= 0 {
+		return errors.New("-bake must be positive")
+	}
+	if awsFlags.region != "" && len(args.regions) != 0 {
+		return errors.New("-region and -regions flags are mutually exclusive")
+	}
+	if len(args.regions) > 1 && strings.HasPrefix(args.name, "arn:") {
+		return errors.New("multiple regions can only be used with the short name or partial ARN")
+	}
+	if len(args.roles) != 0 && strings.Contains(args.name, ":") {
+		return errors.New("-roles can only be used with the short function name")
+	}
+	if (len(args.regions) > 1 || len(args.roles) > 1) && args.output != "" {
+		return errors.New("-o cannot be used with multiple regions or roles")
+	}
+	if args.tail && (len(args.regions) > 1 || len(args.roles) > 1 || args.configFile != "" || args.watch) {
+		return errors.New("-tail cannot be used with multiple regions or roles, -config, or -watch")
+	}
+	if args.changedSince != "" && (args.watch || args.binPath != "" || args.zipPath != "") {
+		return errors.New("-changed-since cannot be used with -watch, -bin, or -zip flags")
+	}
+	return nil
+}
+
+func run(ctx context.Context, args runArgs) (err error) {
+	start := time.Now()
+	if err := args.validate(); err != nil {
+		return withExitCode(exitInvalid, err)
+	}
+	name := args.name
+	prebuilt := args.binPath != "" || args.zipPath != ""
+	if !prebuilt {
+		shortName := name[strings.LastIndexByte(name, ':')+1:]
+		slog.Debug("checking main package in " + args.dir)
+		if err := checkMainPackage(args.dir, shortName, !args.relaxedChecks); err != nil {
+			return withExitCode(exitInvalid, err)
+		}
+		// watch mode and -o are for the code not yet committed
+		if !args.relaxedChecks && !args.watch && args.output == "" {
+			slog.Debug("checking git working tree state")
+			if err := checkGitState(ctx, args.dir); err != nil {
+				return withExitCode(exitInvalid, err)
+			}
+		}
+	}
+	if args.changedSince != "" {
+		changed, err := changedSince(ctx, args.dir, args.changedSince)
+		if err != nil {
+			return fmt.Errorf("listing changes since %s: %w", args.changedSince, err)
+		}
+		deps, err := localDeps(ctx, args.dir, args.tags)
+		if err != nil {
+			return fmt.Errorf("listing package dependencies: %w", err)
+		}
+		if !deps.affectedBy(changed) {
+			slog.Info(fmt.Sprintf("%s: no changes since %s, skipping", name, args.changedSince))
+			if args.detailedExitCode {
+				return errNothingToDeploy
+			}
+			return nil
+		}
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
 		return err
 	}
-	cfg, err := config.LoadDefaultConfig(ctx)
+	slog.Debug("loaded AWS configuration", "region", cfg.Region)
+	if args.audit != nil {
+		// audit log is written with the default credentials, even when
+		// publishing with -roles
+		args.audit.cfg = cfg
+	}
+	if args.sbom != nil {
+		args.sbom.cfg = cfg
+	}
+	if args.provenance != nil {
+		args.provenance.cfg = cfg
+	}
+	if args.cosign != nil {
+		args.cosign.cfg = cfg
+		if err := checkCosign(); err != nil {
+			return withExitCode(exitInvalid, err)
+		}
+	}
+	regions := args.regions
+	if len(regions) == 0 {
+		regions = []string{cfg.Region}
+	}
+	roles := args.roles
+	if len(roles) == 0 {
+		roles = []string{""}
+	}
+	var targets []*target
+	for _, role := range roles {
+		roleCfg := cfg.Copy()
+		var account string
+		if role != "" {
+			roleCfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role))
+			if a, err := arn.Parse(role); err == nil {
+				account = a.AccountID
+			}
+		}
+		for _, region := range regions {
+			c := roleCfg.Copy()
+			c.Region = region
+			t := &target{name: name, role: role, awsCfg: c, svc: lambda.NewFromConfig(c)}
+			switch {
+			case len(roles) > 1 && len(regions) > 1:
+				t.label = account + "/" + region
+			case len(roles) > 1:
+				t.label = account
+			case len(regions) > 1:
+				t.label = region
+			}
+			targets = append(targets, t)
+		}
+	}
+	// failures of the steps shared by all targets, like tests or the build
+	// setup, fail each of them, and are notified about and reported the
+	// same way as the failures of the targets themselves
+	var finished bool
+	defer func() {
+		if err == nil || finished || args.output != "" || args.whyBig {
+			return
+		}
+		deploy := newDeployInfo(ctx, args.dir)
+		for _, t := range targets {
+			if t.err == nil {
+				t.err = err
+			}
+			if t.deploy == nil {
+				t.deploy = deploy
+			}
+		}
+		if err := finish(ctx, &args, name, start, targets); err != nil {
+			slog.Warn(fmt.Sprintf("reporting failure: %v", err))
+		}
+	}()
+	if args.generate && !prebuilt {
+		slog.Debug("running go generate")
+		if err := goGenerate(ctx, args.dir, args.tags); err != nil {
+			return withExitCode(exitBuild, err)
+		}
+	}
+	if args.test && !prebuilt {
+		slog.Debug("running tests")
+		if err := runTests(ctx, args.dir, args.tags); err != nil {
+			return withExitCode(exitBuild, err)
+		}
+	}
+	forEachTarget(targets, func(t *target) error {
+		t.debugf("fetching configuration of function %s", t.name)
+		return t.resolve(ctx, &args)
+	})
+	if args.releaseTag != "" {
+		forEachTarget(targets, func(t *target) error { return withExitCode(exitInvalid, t.checkRelease(ctx, &args)) })
+	}
+	forEachTarget(targets, func(t *target) error {
+		return withExitCode(exitInvalid, t.checkFailureDestination(ctx, &args))
+	})
+	forEachTarget(targets, func(t *target) error { return withExitCode(exitInvalid, t.checkCodeSigning(ctx, &args)) })
+	if args.envCheck != nil {
+		// one at a time, as the check may ask for confirmation
+		for _, t := range targets {
+			if t.err == nil {
+				t.err = withExitCode(exitInvalid, t.checkEnvDrift(&args))
+			}
+		}
+	}
+
+	tdir, err := os.MkdirTemp("", "publish-go-lambda-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tdir)
+	includes, err := includeEntries(args.includes)
+	if err != nil {
+		return err
+	}
+	ignore, err := loadIgnoreRules(filepath.Join(args.dir, ignoreFile))
 	if err != nil {
 		return err
 	}
-	svc := lambda.NewFromConfig(cfg)
-	cfgOutput, err := svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
-		FunctionName: &name,
-		Qualifier:    aws.String("$LATEST"),
+	includes = ignore.filter(includes)
+	if args.toolchain != "" && !prebuilt && !args.buildInDocker {
+		if err := checkToolchain(args.dir, args.toolchain); err != nil {
+			return withExitCode(exitBuild, err)
+		}
+	}
+	if (args.vulncheck != "" || args.lint) && !prebuilt {
+		// check code the way it is going to be built
+		arch, tags := goArm64, args.tags
+		for _, t := range targets {
+			if t.err == nil {
+				arch, tags = t.arch, t.buildTags(&args)
+				break
+			}
+		}
+		if args.lint {
+			if err := lint(ctx, args.dir, arch, tags); err != nil {
+				return withExitCode(exitBuild, err)
+			}
+		}
+		if args.vulncheck != "" {
+			if err := vulncheck(ctx, args.dir, arch, tags, args.vulncheck == "warn"); err != nil {
+				return withExitCode(exitBuild, err)
+			}
+		}
+	}
+	imports := make(map[string][]string) // by arch and build tags
+	for _, t := range targets {
+		if t.err != nil || t.cfg == nil {
+			continue
+		}
+		var pkgs []string
+		if !prebuilt {
+			tags := t.buildTags(&args)
+			key := t.arch + ":" + strings.Join(tags, ",")
+			if _, ok := imports[key]; !ok {
+				if imports[key], err = packageImports(ctx, args.dir, t.arch, tags); err != nil {
+					t.warnf("listing package imports to check function configuration: %v", err)
+				}
+			}
+			pkgs = imports[key]
+			t.checkTracing(&args, pkgs)
+		}
+		if t.err = withExitCode(exitInvalid, t.checkVPC(ctx, &args, pkgs)); t.err != nil {
+			continue
+		}
+		if len(t.cfg.FileSystemConfigs) != 0 {
+			var refs []string
+			if !prebuilt {
+				if refs, err = mountPathRefs(ctx, args.dir, t.buildTags(&args)); err != nil {
+					t.warnf("looking for mount paths in code: %v", err)
+				}
+			}
+			t.err = withExitCode(exitInvalid, t.checkFileSystems(ctx, refs))
+		}
+	}
+	deploy := newDeployInfo(ctx, args.dir)
+	var pgo, pgoDesc string
+	if !prebuilt && args.buildCmd == "" && args.compiler == "gc" {
+		if pgo, pgoDesc, err = resolvePGO(ctx, cfg, args.pgo, args.dir, tdir); err != nil {
+			return err
+		}
+	}
+	// explicit -X values go last to take precedence
+	vars := append(stampVars(ctx, args.dir, args.stampVars), args.vars...)
+	// build results, keyed by Go arch and build tags
+	binaries := make(map[string]string)
+	unpacked := make(map[string]string) // binaries before UPX compression
+	helpers := make(map[string][]zipEntry)
+	extensions := make(map[string][]zipEntry)
+	buildErrs := make(map[string]error)
+	buildTimes := make(map[string]time.Duration)
+	packages := make(map[[2]string]*packageFile)
+	secretScans := make(map[string][]string) // by file path
+	buildCtx := ctx
+	if args.buildTimeout > 0 {
+		var cancel context.CancelFunc
+		buildCtx, cancel = context.WithTimeout(ctx, args.buildTimeout)
+		defer cancel()
+	}
+	for _, t := range targets {
+		if t.err != nil {
+			continue
+		}
+		tags := t.buildTags(&args)
+		opts := &buildOptions{arch: t.arch, tags: tags, vars: vars, cgo: args.cgo, cc: args.cc, compiler: args.compiler,
+			toolchain: args.toolchain, pgo: pgo}
+		if args.buildInDocker {
+			opts.image = args.buildImage
+		}
+		if args.cgo && args.cc == "" && !args.buildInDocker {
+			if opts.cc, opts.cxx, err = zigCompilers(t.arch); err != nil {
+				return withExitCode(exitBuild, err)
+			}
+		}
+		key := t.arch + ":" + strings.Join(tags, ",")
+		if err, ok := buildErrs[key]; ok {
+			t.err = err
+			continue
+		}
+		binPath, ok := binaries[key]
+		if !ok {
+			slog.Debug("building binary", "arch", t.arch, "tags", strings.Join(tags, ","))
+			start := time.Now()
+			switch {
+			case args.binPath != "":
+				binPath = args.binPath
+			case args.zipPath != "":
+				dir := filepath.Join(tdir, t.arch)
+				if err = os.Mkdir(dir, 0700); err == nil {
+					binPath, err = unzipBinary(args.zipPath, dir, t.binaryName)
+				}
+			default:
+				binPath = filepath.Join(tdir, "main-"+t.arch)
+				if args.buildCmd != "" {
+					err = runBuildCmd(buildCtx, args.buildCmd, args.dir, opts, binPath)
+				} else {
+					err = buildBinary(buildCtx, args.dir, opts, binPath)
+				}
+			}
+			if err == nil {
+				err = checkBinary(binPath, t.arch)
+			}
+			if err == nil && args.whyBig {
+				err = sizeReport(os.Stdout, binPath, args.dir, key)
+			}
+			unpacked[key] = binPath
+			if err == nil && args.upx != 0 {
+				dir := filepath.Join(tdir, "upx-"+t.arch)
+				if err = os.Mkdir(dir, 0700); err == nil {
+					binPath, err = upxCompress(binPath, dir, args.upx)
+				}
+			}
+			if err == nil {
+				helpers[key], err = buildHelpers(buildCtx, args.helpers, opts, filepath.Join(tdir, "helpers-"+t.arch))
+			}
+			if err == nil && len(args.extensions) != 0 {
+				var specs []string
+				if specs, err = extensionSpecs(args.extensions); err == nil {
+					extensions[key], err = buildHelpers(buildCtx, specs, opts, filepath.Join(tdir, "extensions-"+t.arch))
+				}
+			}
+			if err != nil && buildCtx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("build did not complete in %v: %w", args.buildTimeout, err)
+			}
+			if err != nil {
+				err = withExitCode(exitBuild, err)
+				buildErrs[key], t.err = err, err
+				continue
+			}
+			binaries[key], buildTimes[key] = binPath, time.Since(start)
+		}
+		if args.cgo {
+			runtime := types.RuntimeProvidedal2023 // for functions created with -create
+			if t.cfg != nil {
+				runtime = t.cfg.Runtime
+			}
+			if err := checkGlibc(unpacked[key], runtimeGlibc(runtime)); err != nil {
+				t.err = withExitCode(exitBuild, err)
+				continue
+			}
+		}
+		if args.sbom != nil || args.provenance != nil {
+			bi, err := buildinfo.ReadFile(unpacked[key])
+			if err != nil {
+				t.warnf("reading build information of the binary: %v", err)
+			}
+			t.buildInfo = bi
+		}
+		t.description = deploy.versionDescription(pgoDesc)
+		t.buildTime = buildTimes[key]
+		t.entries = []zipEntry{{name: t.binaryName, path: binPath, mode: 0775}}
+		if t.oldHandler != "" {
+			t.entries = append(t.entries, zipEntry{name: t.oldHandler, path: binPath, mode: 0775})
+		}
+		t.entries = append(t.entries, helpers[key]...)
+		t.entries = append(t.entries, includes...)
+		t.extensions = extensions[key]
+		if t.err = t.checkSecrets(&args, secretScans); t.err != nil {
+			continue
+		}
+		if t.imageRepo != "" {
+			continue
+		}
+		pkgKey := [2]string{key, t.binaryName + "," + t.oldHandler}
+		if t.pkg = packages[pkgKey]; t.pkg != nil {
+			continue
+		}
+		t.debugf("packaging %d files", len(t.entries))
+		if t.pkg, t.err = zipToFile(filepath.Join(tdir, fmt.Sprintf("package-%d.zip", len(packages))), t.entries,
+			args.compression, t.logf); t.err == nil {
+			packages[pkgKey] = t.pkg
+		}
+	}
+	if args.maxSize != 0 || args.maxUnzippedSize != 0 {
+		forEachTarget(targets, func(t *target) error { return withExitCode(exitInvalid, t.checkSize(&args)) })
+	}
+	if args.whyBig {
+		return report(targets)
+	}
+	if args.output == "" {
+		if args.codeStorage == nil {
+			args.codeStorage = make(codeStorage)
+		}
+		for _, t := range targets {
+			if t.err == nil {
+				t.checkCodeStorage(ctx, args.codeStorage)
+			}
+		}
+	}
+	if args.output != "" {
+		if t := targets[0]; t.err != nil {
+			return t.err
+		}
+		if targets[0].imageRepo != "" {
+			return errors.New("-o cannot be used with Image type packaged Lambdas")
+		}
+		return targets[0].pkg.copyTo(args.output)
+	}
+	deploy.start = time.Now()
+	for _, t := range targets {
+		t.deploy = deploy
+	}
+	forEachTarget(targets, func(t *target) error {
+		start := time.Now()
+		defer func() { t.publishTime = time.Since(start) }()
+		t.debugf("publishing")
+		if err := t.publish(ctx, &args); err != nil {
+			return err
+		}
+		if args.functionURL != "" {
+			if err := t.ensureFunctionURL(ctx, &args); err != nil {
+				return fmt.Errorf("function URL: %w", err)
+			}
+		}
+		if args.logRetention != 0 {
+			if err := t.ensureLogGroup(ctx, &args, args.logRetention); err != nil {
+				return fmt.Errorf("log group: %w", err)
+			}
+		}
+		t.debugf("publish took %v, recording deploy", time.Since(start).Round(time.Millisecond))
+		if err := t.recordDeploy(ctx, &args); err != nil {
+			return err
+		}
+		if t.nearQuota && args.pruneKeep != 0 && t.version != "" && !args.dryRun {
+			if err := t.pruneVersions(ctx, args.pruneKeep); err != nil {
+				t.warnf("pruning old versions: %v", err)
+			}
+		}
+		return nil
+	})
+	finished = true
+	if err := finish(ctx, &args, name, start, targets); err != nil {
+		return err
+	}
+	if err := report(targets); err != nil {
+		return err
+	}
+	if args.detailedExitCode && !args.dryRun && !slices.ContainsFunc(targets, func(t *target) bool { return t.version != "" }) {
+		return errNothingToDeploy
+	}
+	if args.tail && !args.dryRun {
+		return targets[0].tail(ctx, deploy.start)
+	}
+	return nil
+}
+
+// target is the Lambda function in a single account and region to publish
+// code to
+type target struct {
+	name   string // function name or ARN
+	label  string // prefix for log messages, set when there are multiple targets
+	role   string // role assumed to publish, empty for the default credentials
+	awsCfg aws.Config
+	svc    *lambda.Client
+
+	cfg        *lambda.GetFunctionConfigurationOutput
+	binaryName string       // file name of the binary inside zip
+	oldHandler string       // go1.x handler name, set when migrating to provided.al2023
+	arch       string       // Go arch
+	entries    []zipEntry   // files to package: binary and extra files
+	pkg        *packageFile // deployment package, nil for Image type packaged functions
+	imageRepo  string       // ECR repository, set for Image type packaged functions
+	extensions []zipEntry   // extension binaries, to put under /opt
+
+	description string      // description of the version to publish
+	version     string      // published version
+	deploy      *deployInfo // shared by all targets
+	callerArn   string      // see caller method
+	record      *deployRecord
+	codeSha256  string // of the uploaded code
+	buildTime   time.Duration
+	publishTime time.Duration
+
+	configChanged bool // function configuration was updated before publishing code
+
+	prevConcurrency    *int32           // reserved concurrency before the deploy, nil if not reserved
+	concurrencyChanged bool             // set if reserved concurrency was changed by the deploy
+	functionURL        string           // Function URL, set with -function-url
+	signingProfile     string           // signing profile version ARN to sign the package with, see checkCodeSigning
+	nearQuota          bool             // publishing gets account code storage close to the quota
+	buildInfo          *debug.BuildInfo // of the binary, set with -sbom or -provenance
+	cosignBundle       []byte           // Sigstore bundle of the package, set with -cosign
+	err                error            // once set, target is skipped
+}
+
+// buildTags returns build tags to build the target binary with
+func (t *target) buildTags(args *runArgs) []string {
+	tags := args.tags
+	if t.binaryName == "bootstrap" && t.oldHandler == "" && !args.rpc {
+		// provided runtimes don't need the RPC server of the
+		// github.com/aws/aws-lambda-go/lambda package; binary migrated
+		// from go1.x must still serve it until the runtime is switched
+		tags = append(tags[:len(tags):len(tags)], "lambda.norpc")
+	}
+	return tags
+}
+
+// where returns target label, or its region if label is not set
+func (t *target) where() string {
+	if t.label != "" {
+		return t.label
+	}
+	return t.awsCfg.Region
+}
+
+// unqualifiedArn returns the function ARN without the $LATEST qualifier
+// t.cfg is fetched with, as APIs like ListTags only accept unqualified ARNs
+func (t *target) unqualifiedArn() string {
+	return strings.TrimSuffix(aws.ToString(t.cfg.FunctionArn), ":$LATEST")
+}
+
+func (t *target) logf(format string, args ...any) {
+	t.log(slog.LevelInfo, format, args...)
+}
+
+// archChange describes the function architecture for the dry run output:
+// either the current one, or the switch to the one the code is built for
+func (t *target) archChange() string {
+	current, arch := t.cfg.Architectures[0], lambdaArch(t.arch)
+	if current == arch {
+		return string(arch)
+	}
+	return fmt.Sprintf("%s, switching to %s", current, arch)
+}
+
+// debugf logs a debug message about the target
+func (t *target) debugf(format string, args ...any) {
+	t.log(slog.LevelDebug, format, args...)
+}
+
+// warnf logs a warning about the target
+func (t *target) warnf(format string, args ...any) {
+	t.log(slog.LevelWarn, format, args...)
+}
+
+func (t *target) log(level slog.Level, format string, args ...any) {
+	var attrs []any
+	if t.label != "" {
+		attrs = append(attrs, "target", t.label)
+	}
+	slog.Log(context.Background(), level, fmt.Sprintf(format, args...), attrs...)
+}
+
+// resolve fetches function configuration and figures out how code must be
+// built and packaged for it. If function does not exist and args.create is
+// set, target is prepared for creating a new function.
+func (t *target) resolve(ctx context.Context, args *runArgs) error {
+	qualifier := "$LATEST"
+	if args.qualifier != "" {
+		qualifier = args.qualifier
+	}
+	cfgOutput, err := t.svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &t.name,
+		Qualifier:    &qualifier,
 	})
+	var notFound *types.ResourceNotFoundException
+	if args.create && errors.As(err, &notFound) {
+		t.binaryName, t.arch = "bootstrap", args.arch
+		if t.arch == "" {
+			t.arch = goArm64
+		}
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("GetFunctionConfiguration: %w", err)
 	}
+	if qualifier != "$LATEST" {
+		// code is updated and versions are published from $LATEST, so it
+		// must be configured the same way as the qualified version
+		latest, err := t.svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+			FunctionName: &t.name,
+			Qualifier:    aws.String("$LATEST"),
+		})
+		if err != nil {
+			return fmt.Errorf("GetFunctionConfiguration: %w", err)
+		}
+		if err := sameRuntime(cfgOutput, latest); err != nil {
+			return fmt.Errorf("$LATEST is configured differently from %s: %w", qualifier, err)
+		}
+		cfgOutput = latest
+	}
+	if cfgOutput.PackageType == types.PackageTypeImage {
+		if err := t.resolveImage(ctx, cfgOutput); err != nil {
+			return err
+		}
+		if args.arch != "" {
+			t.arch = args.arch
+		}
+		return nil
+	}
 	if cfgOutput.PackageType != types.PackageTypeZip {
-		return fmt.Errorf("only ZIP type packaged Lambdas supported, but this one is deployed as %v", cfgOutput.PackageType)
+		return fmt.Errorf("only ZIP or Image type packaged Lambdas supported, but this one is deployed as %v", cfgOutput.PackageType)
 	}
 	// Go Lambdas can be deployed as:
 	//
 	// 1. "go1.x" Lambda runtime and "x86_64" arch, in this case the binary
 	// must be named after the handler name
 	//
-	// 2. "provided.al2" Lambda runtime and (arch either "x86_64" OR "arm64"),
-	// in this case the binary name must be always named "bootstrap"
+	// 2. "provided.al2" or "provided.al2023" Lambda runtime and (arch either
+	// "x86_64" OR "arm64"), in this case the binary name must be always named
+	// "bootstrap"
 	var binaryName, lambdaArch string
 	if len(cfgOutput.Architectures) != 1 {
 		return fmt.Errorf("expected single supported architecture, got %v", cfgOutput.Architectures)
@@ -86,7 +1157,12 @@ func run(ctx context.Context, name string, relaxedChecks bool) error {
 		}
 		binaryName = *cfgOutput.Handler
 		lambdaArch = goAmd64
-	case types.RuntimeProvidedal2:
+		if args.migrateRuntime {
+			// package has the binary under both names, so that it runs
+			// both before and after the runtime switch
+			binaryName, t.oldHandler = "bootstrap", binaryName
+		}
+	case types.RuntimeProvidedal2, types.RuntimeProvidedal2023:
 		binaryName = "bootstrap"
 		switch arch := cfgOutput.Architectures[0]; arch {
 		case types.ArchitectureX8664:
@@ -98,74 +1174,671 @@ func run(ctx context.Context, name string, relaxedChecks bool) error {
 				cfgOutput.Runtime, types.ArchitectureX8664, types.ArchitectureArm64, arch)
 		}
 	default:
-		return fmt.Errorf("lambda configured with unsupported runtime, want %s or %s", types.RuntimeGo1x, types.RuntimeProvidedal2)
+		return fmt.Errorf("lambda configured with unsupported runtime, want one of: %s, %s, %s",
+			types.RuntimeGo1x, types.RuntimeProvidedal2, types.RuntimeProvidedal2023)
 	}
-	zipData, err := buildAndZip(".", lambdaArch, binaryName)
-	if err != nil {
+	if args.arch != "" && args.arch != lambdaArch {
+		if cfgOutput.Runtime == types.RuntimeGo1x {
+			return fmt.Errorf("cannot switch architecture: %v runtime only supports %v arch"+
+				" (migrate to %v runtime first)", cfgOutput.Runtime, types.ArchitectureX8664, types.RuntimeProvidedal2023)
+		}
+		lambdaArch = args.arch
+	}
+	if msg, deprecated := runtimeStatus(cfgOutput.Runtime, time.Now()); msg != "" && t.oldHandler == "" {
+		if deprecated && args.failDeprecated {
+			return withExitCode(exitDeprecated, errors.New(msg))
+		}
+		t.warnf("%s", msg)
+	}
+	t.cfg, t.binaryName, t.arch = cfgOutput, binaryName, lambdaArch
+	return nil
+}
+
+// sameRuntime returns an error if configurations differ in any way that
+// affects how the function code must be built
+func sameRuntime(a, b *lambda.GetFunctionConfigurationOutput) error {
+	switch {
+	case a.PackageType != b.PackageType:
+		return fmt.Errorf("package type %s vs %s", a.PackageType, b.PackageType)
+	case a.Runtime != b.Runtime:
+		return fmt.Errorf("runtime %s vs %s", a.Runtime, b.Runtime)
+	case !slices.Equal(a.Architectures, b.Architectures):
+		return fmt.Errorf("architecture %v vs %v", a.Architectures, b.Architectures)
+	case aws.ToString(a.Handler) != aws.ToString(b.Handler):
+		return fmt.Errorf("handler %q vs %q", aws.ToString(a.Handler), aws.ToString(b.Handler))
+	}
+	return nil
+}
+
+// publish uploads code to the function, unless it's already running the same
+// code
+func (t *target) publish(ctx context.Context, args *runArgs) error {
+	var version string
+	if t.cfg == nil {
+		if args.dryRun {
+			t.logf("dry run, function %s does not exist and would be created", t.name)
+			t.logf("runtime:\t%s (%s)", types.RuntimeProvidedal2023, lambdaArch(t.arch))
+			t.logf("package size:\t%d bytes", t.pkg.size)
+			return nil
+		}
+		var err error
+		if version, err = t.create(ctx, args); err != nil {
+			return err
+		}
+		t.logf("created function %s, version %s", aws.ToString(t.cfg.FunctionArn), version)
+		t.codeSha256 = aws.ToString(t.cfg.CodeSha256)
+		t.version = version
+	} else {
+		if !args.dryRun {
+			if err := t.waitActive(ctx, args.timeout); err != nil {
+				return err
+			}
+		}
+		if err := t.prepare(ctx, args); err != nil {
+			return err
+		}
+		update := t.updateCode
+		if t.imageRepo != "" {
+			update = t.updateImage
+		}
+		var err error
+		if version, err = update(ctx, args); err != nil {
+			return err
+		}
+		if version != "" {
+			t.logf("published version %s", version)
+			t.version = version
+		}
+	}
+	// reserved concurrency is the function setting, not the version one, so
+	// it is applied even if no new version is published
+	if args.reservedConcurrency != nil && !args.dryRun {
+		if err := t.setConcurrency(ctx, *args.reservedConcurrency); err != nil {
+			return fmt.Errorf("setting reserved concurrency: %w", err)
+		}
+	}
+	if version == "" {
+		return nil
+	}
+	if args.smokePayload != nil {
+		if err := t.smokeTest(ctx, version, args.smokePayload, args.timeout); err != nil {
+			if args.rollbackOnFailure {
+				return t.restoreCode(ctx, err, args.timeout)
+			}
+			return err
+		}
+	}
+	if args.provisionedConcurrency == 0 {
+		return t.shiftTraffic(ctx, args, version)
+	}
+	if err := t.provision(ctx, version, args.provisionedConcurrency, args.timeout); err != nil {
+		return fmt.Errorf("provisioning concurrency: %w", err)
+	}
+	if err := t.shiftTraffic(ctx, args, version); err != nil {
+		// new version may be left without traffic
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if rerr := t.releaseProvisioned(ctx, ""); rerr != nil {
+			t.warnf("releasing provisioned concurrency: %v", rerr)
+		}
 		return err
 	}
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	if err := t.releaseProvisioned(ctx, version); err != nil {
+		return fmt.Errorf("releasing provisioned concurrency: %w", err)
+	}
+	return nil
+}
+
+// shiftTraffic points args.alias to the published version, directly or
+// through the canary, if alias is set
+func (t *target) shiftTraffic(ctx context.Context, args *runArgs, version string) error {
+	if args.alias == "" {
+		return nil
+	}
+	if args.canaryWeight != 0 {
+		return t.canary(ctx, args, version)
+	}
+	if err := t.pointAlias(ctx, args.alias, version); err != nil {
+		return fmt.Errorf("updating alias %s: %w", args.alias, err)
+	}
+	t.logf("alias %s now points to version %s", args.alias, version)
+	return nil
+}
+
+// updateCode uploads code of the existing function, unless it's already
+// running the same code, and returns the published version. If code is not
+// uploaded, it returns an empty version.
+func (t *target) updateCode(ctx context.Context, args *runArgs) (string, error) {
+	// Lambda reports CodeSha256 as base64-encoded SHA-256 of the deployment
+	// package
+	codeSha256 := t.pkg.codeSha256()
+	t.codeSha256 = codeSha256
+	if codeSha256 == aws.ToString(t.cfg.CodeSha256) {
+		if t.configChanged && !args.dryRun {
+			return t.publishVersion(ctx, t.cfg.CodeSha256, t.cfg.RevisionId)
+		}
+		t.logf("function code is up to date (sha256 %s), nothing to publish", codeSha256)
+		return "", nil
+	}
+	if args.dryRun {
+		t.logf("dry run, not updating function %s", aws.ToString(t.cfg.FunctionArn))
+		t.logf("runtime:\t%s (%s)", t.cfg.Runtime, t.archChange())
+		if t.oldHandler != "" {
+			t.logf("migration:\truntime %s -> %s, handler %s -> %s", t.cfg.Runtime, types.RuntimeProvidedal2023,
+				t.oldHandler, t.binaryName)
+		}
+		t.logf("binary name:\t%s", t.binaryName)
+		t.logf("package size:\t%d bytes", t.pkg.size)
+		t.logf("code sha256:\t%s", codeSha256)
+		if t.signingProfile != "" {
+			t.logf("signing profile:\t%s", t.signingProfile)
+		}
+		if args.cosign != nil {
+			t.logf("cosign:\ts3://%s/%s", args.cosign.bucket, args.cosign.prefix)
+		}
+		t.logf("revision id:\t%s", aws.ToString(t.cfg.RevisionId))
+		if t.description != "" {
+			t.logf("description:\t%s", t.description)
+		}
+		if args.alias != "" {
+			t.logf("alias:\t%s", args.alias)
+		}
+		if args.reservedConcurrency != nil {
+			t.logf("reserved concurrency:\t%s", concurrencyString(reservation(*args.reservedConcurrency)))
+		}
+		if args.provisionedConcurrency != 0 {
+			t.logf("provisioned concurrency:\t%d", args.provisionedConcurrency)
+		}
+		return "", nil
+	}
+	if args.cosign != nil {
+		var err error
+		if t.cosignBundle, err = t.cosignPackage(ctx, args.cosignKey); err != nil {
+			return "", err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, args.timeout)
 	defer cancel()
-	_, err = svc.UpdateFunctionCode(ctx, &lambda.UpdateFunctionCodeInput{
-		FunctionName: &name,
-		RevisionId:   cfgOutput.RevisionId,
-		ZipFile:      zipData,
-		Publish:      true,
+	if t.signingProfile != "" {
+		bucket, key, err := t.signPackage(ctx, args.signingLocation, t.signingProfile)
+		if err != nil {
+			return "", fmt.Errorf("signing package: %w", err)
+		}
+		return t.publishCode(ctx, args, &lambda.UpdateFunctionCodeInput{S3Bucket: &bucket, S3Key: &key})
+	}
+	code, err := t.code(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	return t.publishCode(ctx, args, &lambda.UpdateFunctionCodeInput{
+		ZipFile:         code.ZipFile,
+		S3Bucket:        code.S3Bucket,
+		S3Key:           code.S3Key,
+		S3ObjectVersion: code.S3ObjectVersion,
 	})
-	return err
 }
 
-func buildAndZip(dir, arch, handlerName string) ([]byte, error) {
-	tdir, err := ioutil.TempDir("", "publish-go-lambda-*")
+// publishCode updates function code and publishes a new version. If
+// t.description is set, version is published separately, once the code
+// update completes, to set the version description. With args.wait it waits
+// for the update to complete either way, so that its failure is reported.
+// When migrating from go1.x, runtime is switched after the code update, but
+// before the version is published.
+func (t *target) publishCode(ctx context.Context, args *runArgs, in *lambda.UpdateFunctionCodeInput) (string, error) {
+	in.FunctionName = &t.name
+	in.Publish = t.description == "" && t.oldHandler == ""
+	if arch := lambdaArch(t.arch); arch != t.cfg.Architectures[0] {
+		t.logf("switching function architecture from %s to %s", t.cfg.Architectures[0], arch)
+		in.Architectures = []types.Architecture{arch}
+	}
+	var out *lambda.UpdateFunctionCodeOutput
+	err := t.retryStale(ctx, args, func() error {
+		in.RevisionId = t.cfg.RevisionId
+		return t.retryConflicts(ctx, func() error {
+			var err error
+			out, err = t.svc.UpdateFunctionCode(ctx, in)
+			return err
+		})
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer os.RemoveAll(tdir)
-	binPath := filepath.Join(tdir, "main")
-	cmd := exec.Command("go", "build", "-ldflags=-s -w", "-trimpath",
-		"-o", binPath)
+	if in.S3Key != nil {
+		// signed package differs from the built one
+		t.codeSha256 = aws.ToString(out.CodeSha256)
+	}
+	if in.Publish && !args.wait {
+		return aws.ToString(out.Version), nil
+	}
+	if _, err := t.waitUpdated(ctx); err != nil {
+		return "", err
+	}
+	if in.Publish {
+		return aws.ToString(out.Version), nil
+	}
+	if t.oldHandler != "" {
+		t.logf("switching runtime from %s to %s", t.cfg.Runtime, types.RuntimeProvidedal2023)
+		if err := t.updateConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+			Runtime: types.RuntimeProvidedal2023,
+			Handler: &t.binaryName,
+		}); err != nil {
+			return "", fmt.Errorf("code is updated, but switching runtime failed: %w", err)
+		}
+	}
+	return t.publishVersion(ctx, out.CodeSha256, nil)
+}
+
+// prepare updates function configuration that has to be changed before the
+// new code is uploaded
+func (t *target) prepare(ctx context.Context, args *runArgs) error {
+	if len(t.extensions) != 0 && t.imageRepo == "" {
+		if err := t.syncExtensions(ctx, args); err != nil {
+			return fmt.Errorf("publishing extensions: %w", err)
+		}
+	}
+	if len(args.env) != 0 {
+		if err := t.syncEnvironment(ctx, args); err != nil {
+			return fmt.Errorf("updating environment variables: %w", err)
+		}
+	}
+	if args.insights {
+		if err := t.enableInsights(ctx, args); err != nil {
+			return fmt.Errorf("enabling Lambda Insights: %w", err)
+		}
+	}
+	if args.adot != "" {
+		if err := t.enableADOT(ctx, args); err != nil {
+			return fmt.Errorf("enabling ADOT collector: %w", err)
+		}
+	}
+	if t.imageRepo == "" {
+		if err := t.syncRuntimeUpdate(ctx, args); err != nil {
+			return fmt.Errorf("updating runtime management configuration: %w", err)
+		}
+	}
+	if err := t.syncResources(ctx, args); err != nil {
+		return fmt.Errorf("updating function configuration: %w", err)
+	}
+	// handler of the migrated function is updated with the runtime
+	if handler := aws.ToString(t.cfg.Handler); t.imageRepo == "" && t.oldHandler == "" && handler != t.binaryName {
+		switch {
+		case !args.fixHandler:
+			t.warnf("function handler is %q, but the binary is %s; %s runtime ignores it, but tools reading it may not,"+
+				" use -fix-handler flag to update it", handler, t.binaryName, t.cfg.Runtime)
+		case args.dryRun:
+			t.logf("dry run, would update function handler from %q to %q", handler, t.binaryName)
+		default:
+			t.logf("updating function handler from %q to %q", handler, t.binaryName)
+			if err := t.updateConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{Handler: &t.binaryName}); err != nil {
+				return fmt.Errorf("updating handler: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// updateConfiguration updates function configuration, waits until update is
+// complete, and refreshes t.cfg
+func (t *target) updateConfiguration(ctx context.Context, in *lambda.UpdateFunctionConfigurationInput) error {
+	in.FunctionName, in.RevisionId = &t.name, t.cfg.RevisionId
+	if err := t.retryConflicts(ctx, func() error {
+		_, err := t.svc.UpdateFunctionConfiguration(ctx, in)
+		return err
+	}); err != nil {
+		return fmt.Errorf("UpdateFunctionConfiguration: %w", err)
+	}
+	cfg, err := t.waitUpdated(ctx)
+	if err != nil {
+		return err
+	}
+	t.cfg, t.configChanged = cfg, true
+	return nil
+}
+
+// publishVersion publishes a new version from the current $LATEST code and
+// configuration, with t.description as the version description. Publishing
+// fails if $LATEST code does not match codeSha256.
+func (t *target) publishVersion(ctx context.Context, codeSha256, revisionID *string) (string, error) {
+	in := &lambda.PublishVersionInput{
+		FunctionName: &t.name,
+		CodeSha256:   codeSha256,
+		RevisionId:   revisionID,
+	}
+	if t.description != "" {
+		in.Description = &t.description
+	}
+	var out *lambda.PublishVersionOutput
+	err := t.retryConflicts(ctx, func() error {
+		var err error
+		out, err = t.svc.PublishVersion(ctx, in)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("PublishVersion: %w", err)
+	}
+	return aws.ToString(out.Version), nil
+}
+
+// pointAlias makes function alias point to the version, creating alias if
+// it does not exist
+func (t *target) pointAlias(ctx context.Context, alias, version string) error {
+	_, err := t.svc.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    &t.name,
+		Name:            &alias,
+		FunctionVersion: &version,
+	})
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	_, err = t.svc.CreateAlias(ctx, &lambda.CreateAliasInput{
+		FunctionName:    &t.name,
+		Name:            &alias,
+		FunctionVersion: &version,
+	})
+	return err
+}
+
+// forEachTarget concurrently calls fn on targets that have no error recorded
+// yet, recording errors fn returns
+func forEachTarget(targets []*target, fn func(*target) error) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if t.err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.err = fn(t)
+		}()
+	}
+	wg.Wait()
+}
+
+// finish sends -notify-url notifications about the outcome of publishing to
+// the targets, and writes it out for -json and GitHub Actions
+func finish(ctx context.Context, args *runArgs, name string, start time.Time, targets []*target) error {
+	if args.notifyURL != "" && !args.dryRun {
+		for _, t := range targets {
+			if err := t.notify(ctx, args); err != nil {
+				t.warnf("sending notification: %v", err)
+			}
+		}
+	}
+	if args.json {
+		if err := writeResult(os.Stdout, name, start, targets); err != nil {
+			return err
+		}
+	}
+	if !args.dryRun {
+		if err := githubActions(name, start, targets); err != nil {
+			slog.Warn(fmt.Sprintf("writing GitHub Actions outputs: %v", err))
+		}
+	}
+	return nil
+}
+
+// report returns an error if any of the targets failed. If there are
+// multiple targets, it also logs the status of each.
+func report(targets []*target) error {
+	if len(targets) == 1 {
+		return targets[0].err
+	}
+	var failed int
+	for _, t := range targets {
+		if t.err != nil {
+			failed++
+			t.logf("FAILED: %v", t.err)
+			continue
+		}
+		t.logf("OK")
+	}
+	if failed != 0 {
+		// exit with the specific code if all targets failed the same way
+		code := -1
+		for _, t := range targets {
+			if t.err == nil {
+				continue
+			}
+			if c := exitCode(t.err); code == -1 || code == c {
+				code = c
+			} else {
+				code = exitFailure
+			}
+		}
+		return withExitCode(code, fmt.Errorf("failed to publish to %d out of %d targets", failed, len(targets)))
+	}
+	return nil
+}
+
+// goGenerate runs go generate for all packages in dir and below
+func goGenerate(ctx context.Context, dir string, tags []string) error {
+	cmd := exec.CommandContext(ctx, "go", "generate", "-tags="+strings.Join(tags, ","), "./...")
 	cmd.Dir = dir
-	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return nil, err
+		return fmt.Errorf("go generate: %w", err)
 	}
-	f, err := os.Open(binPath)
+	return nil
+}
+
+// checkToolchain verifies that go command in dir runs the given toolchain,
+// downloading it if needed
+func checkToolchain(dir, toolchain string) error {
+	cmd := exec.Command("go", "env", "GOVERSION")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN="+toolchain)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("switching to Go toolchain %s: %w", toolchain, err)
 	}
-	defer f.Close()
-	fi, err := f.Stat()
-	if err != nil {
-		return nil, err
+	if v := string(bytes.TrimSpace(out)); v != toolchain {
+		return fmt.Errorf("want Go toolchain %s, but go command uses %s", toolchain, v)
 	}
-	header, err := zip.FileInfoHeader(fi)
-	if err != nil {
+	return nil
+}
+
+// buildOptions hold parameters of the go build command
+type buildOptions struct {
+	arch string   // Go arch
+	tags []string // build tags
+	vars []string // -X linker flag values, in pkg.Var=value form
+
+	cgo     bool   // build with cgo enabled
+	cc, cxx string // C and C++ compilers for cgo builds
+
+	image     string // image to build inside, see buildInDocker
+	compiler  string // gc (go build) or tinygo
+	toolchain string // GOTOOLCHAIN value
+	pgo       string // go build -pgo value, if not empty
+}
+
+// env returns environment for the go build command
+func (o *buildOptions) env() []string {
+	env := append(os.Environ(), "GOOS=linux", "GOARCH="+o.arch)
+	if o.toolchain != "" {
+		env = append(env, "GOTOOLCHAIN="+o.toolchain)
+	}
+	if o.cgo {
+		env = append(env, "CGO_ENABLED=1", "CC="+o.cc)
+		if o.cxx != "" {
+			env = append(env, "CXX="+o.cxx)
+		}
+	}
+	return env
+}
+
+// ldflags returns value of the -ldflags go build option
+func (o *buildOptions) ldflags() string {
+	flags := []string{"-s", "-w"}
+	for _, v := range o.vars {
+		if strings.ContainsAny(v, " \t\n'\"") {
+			// go build splits -ldflags on spaces, but keeps quoted
+			// strings intact; quotes do not support escaping
+			if strings.Contains(v, "'") {
+				v = `"` + v + `"`
+			} else {
+				v = "'" + v + "'"
+			}
+		}
+		flags = append(flags, "-X", v)
+	}
+	return strings.Join(flags, " ")
+}
+
+// goBuildArgs returns go command arguments to build the binary to binPath,
+// with the profile for profile-guided optimization at pgo, if it's not empty
+func (o *buildOptions) goBuildArgs(pgo, binPath string) []string {
+	args := []string{"build", "-ldflags=" + o.ldflags(), "-trimpath", "-tags=" + strings.Join(o.tags, ",")}
+	if pgo != "" {
+		args = append(args, "-pgo="+pgo)
+	}
+	return append(args, "-o", binPath)
+}
+
+// buildBinary builds Go program in dir for linux, saving resulting binary to
+// binPath
+func buildBinary(ctx context.Context, dir string, opts *buildOptions, binPath string) error {
+	if opts.image != "" {
+		return buildInDocker(ctx, dir, opts, binPath)
+	}
+	cmd := exec.CommandContext(ctx, "go", opts.goBuildArgs(opts.pgo, binPath)...)
+	if opts.compiler == "tinygo" {
+		cmd = exec.CommandContext(ctx, "tinygo", "build", "-opt=z", "-no-debug", "-ldflags="+opts.ldflags(),
+			"-tags="+strings.Join(opts.tags, ","), "-o", binPath)
+	}
+	cmd.Dir = dir
+	cmd.Env = opts.env()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// runBuildCmd builds the binary with a custom shell command run in dir.
+// Command gets GOOS, GOARCH, OUTPUT (path to save the binary to), BUILD_TAGS
+// (comma-separated), and LDFLAGS environment variables.
+func runBuildCmd(ctx context.Context, command, dir string, opts *buildOptions, binPath string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(opts.env(), "OUTPUT="+binPath,
+		"BUILD_TAGS="+strings.Join(opts.tags, ","), "LDFLAGS="+opts.ldflags())
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("build command: %w", err)
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		return fmt.Errorf("build command did not create the binary at $OUTPUT: %w", err)
+	}
+	return nil
+}
+
+// buildHelpers builds additional main packages listed in pkg[:name] form
+// into dir, returning zip entries for them. Binary name inside the archive
+// defaults to the last element of the package directory.
+func buildHelpers(ctx context.Context, specs []string, opts *buildOptions, dir string) ([]zipEntry, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return nil, err
 	}
-	header.Method = zip.Deflate
-	header.Name = handlerName
-	header.SetMode(0775)
+	var out []zipEntry
+	for i, spec := range specs {
+		pkg, name, _ := strings.Cut(spec, ":")
+		if name == "" {
+			abs, err := filepath.Abs(pkg)
+			if err != nil {
+				return nil, err
+			}
+			name = filepath.Base(abs)
+		}
+		binPath := filepath.Join(dir, strconv.Itoa(i))
+		if err := buildBinary(ctx, pkg, opts, binPath); err != nil {
+			return nil, fmt.Errorf("building %s: %w", pkg, err)
+		}
+		out = append(out, zipEntry{name: name, path: binPath, mode: 0775})
+	}
+	return out, nil
+}
+
+// zipEntry describes a single file to put into the deployment package
+type zipEntry struct {
+	name string      // name inside the archive
+	path string      // path to the file on disk
+	mode fs.FileMode // permission bits as stored in the archive
+}
 
+// zipFiles creates a zip archive from given entries. Resulting archive only
+// depends on the entries' names, modes and content: entries are sorted by
+// name and all get the same fixed modification time, so the same input always
+// produces byte-for-byte identical output.
+func zipFiles(entries []zipEntry) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	zw := zip.NewWriter(buf)
+	if err := writeZip(buf, entries, compressionBest, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeZip writes a zip archive of the entries to w compressed with c, see
+// zipFiles. If logf is not nil, it is called with the choices of auto
+// compression.
+func writeZip(w io.Writer, entries []zipEntry, c compression, logf func(format string, args ...any)) error {
+	entries = append([]zipEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	for i := 1; i < len(entries); i++ {
+		if entries[i].name == entries[i-1].name {
+			return fmt.Errorf("more than one file would be saved as %q in the archive", entries[i].name)
+		}
+	}
+	zw := zip.NewWriter(w)
+	var level int // of the entry being added
 	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-		return flate.NewWriter(out, flate.BestCompression)
+		return newParallelWriter(out, level)
 	})
-	w, err := zw.CreateHeader(header)
+	for _, e := range entries {
+		method, l, desc, err := c.method(e.path)
+		if err != nil {
+			return err
+		}
+		if level = l; desc != "" && logf != nil {
+			logf("compression of %s: %s", e.name, desc)
+		}
+		if err := addZipEntry(zw, e, method); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addZipEntry(zw *zip.Writer, e zipEntry, method uint16) error {
+	f, err := os.Open(e.path)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if _, err := io.Copy(w, f); err != nil {
-		return nil, err
+	defer f.Close()
+	header := &zip.FileHeader{
+		Name:     e.name,
+		Method:   method,
+		Modified: zipModTime,
 	}
-	if err := zw.Close(); err != nil {
-		return nil, err
+	header.SetMode(e.mode.Perm())
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
 	}
-	return buf.Bytes(), nil
+	_, err = io.Copy(w, f)
+	return err
 }
 
+// zipModTime is a modification time set on all files in the archive; it is
+// the earliest time representable in the MS-DOS format used by zip
+var zipModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func checkMainPackage(dir, lambdaName string, strict bool) error {
 	if lambdaName == "" {
 		panic("checkMainPackage called with an empty lambdaName")
@@ -215,11 +1888,52 @@ func checkMainPackage(dir, lambdaName string, strict bool) error {
 func init() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s aws-lambda-name\n", filepath.Base(os.Args[0]))
-		fmt.Fprintf(flag.CommandLine.Output(), "\naws-lambda-name is either a short AWS Lambda name, or a fully qualified ARN\n\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "   or: %s -config file [aws-lambda-name...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "   or: %s subcommand [flags] [args...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(flag.CommandLine.Output(), "\naws-lambda-name is either a short AWS Lambda name, or a fully qualified ARN\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\nSubcommands (run with -h for details):\n\n")
+		names := make([]string, 0, len(subcommands))
+		for name := range subcommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %s\n    \t%s\n", name, subcommands[name].summary)
+		}
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
 		flag.PrintDefaults()
 	}
 }
 
+type subcommand struct {
+	run     func(ctx context.Context, args []string) error
+	summary string
+}
+
+// subcommands are called with the command line arguments that follow the
+// subcommand name
+var subcommands = map[string]subcommand{
+	"history":  {historyCmd, "show published versions with their git commits and deploy details"},
+	"init":     {initCmd, "create a minimal main package for the new Lambda"},
+	"invoke":   {invokeCmd, "invoke function and print the result"},
+	"layer":    {layerCmd, "publish a new layer version, optionally attaching it to a function"},
+	"prune":    {pruneCmd, "delete old published versions not referenced by aliases or event source mappings"},
+	"rollback": {rollbackCmd, "re-publish code of the previous version, or point alias to it"},
+	"sbom":     {sbomCmd, "print SBOM of the published version, written with -sbom flag"},
+	"verify":   {verifyCmd, "verify provenance of the published version, written with -provenance flag"},
+	"versions": {versionsCmd, "list published versions and aliases pointing to them"},
+}
+
+// splitList splits comma-separated list, dropping empty elements
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 const goAmd64 = "amd64"
 const goArm64 = "arm64"
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notification is the data webhook payload template is executed with
+type notification struct {
+	Function  string // function name
+	Target    string // account/region
+	Version   string // published version, empty on failure
+	Outcome   string // success or failure
+	Error     string // error message on failure
+	Size      int    // deployment package size, 0 for container images
+	SizeDelta int    // change of the package size since the previous version
+	Commit    string
+	Branch    string
+	Text      string // human-readable summary
+}
+
+// defaultNotifyTemplate works with Slack and Microsoft Teams incoming
+// webhooks, which show the text field
+const defaultNotifyTemplate = `{"text":{{json .Text}},"function":{{json .Function}},"target":{{json .Target}},` +
+	`"version":{{json .Version}},"outcome":{{json .Outcome}},"error":{{json .Error}},"size":{{.Size}},` +
+	`"sizeDelta":{{.SizeDelta}},"commit":{{json .Commit}},"branch":{{json .Branch}}}`
+
+// loadNotifyTemplate parses payload template from file, or the default one
+// if file is empty
+func loadNotifyTemplate(file string) (*template.Template, error) {
+	text := defaultNotifyTemplate
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	return template.New("notify").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// notify posts the outcome of publishing to the target to the webhook. It
+// does nothing if nothing was published and there was no error.
+func (t *target) notify(ctx context.Context, args *runArgs) error {
+	if t.err == nil && t.version == "" {
+		return nil
+	}
+	n := notification{
+		Function: t.name,
+		Target:   t.where(),
+		Version:  t.version,
+		Outcome:  "success",
+		Size:     int(t.pkg.len()),
+		Commit:   t.deploy.commit,
+		Branch:   t.deploy.branch,
+	}
+	if t.cfg != nil && n.Size != 0 {
+		n.SizeDelta = n.Size - int(t.cfg.CodeSize)
+	}
+	if t.err != nil {
+		n.Outcome, n.Error = "failure", t.err.Error()
+		n.Text = fmt.Sprintf("Publishing %s (%s) failed: %v", t.name, n.Target, t.err)
+	} else {
+		n.Text = fmt.Sprintf("Published %s (%s) version %s", t.name, n.Target, t.version)
+		if n.Commit != "" {
+			n.Text += " from " + n.Commit[:min(len(n.Commit), 12)]
+		}
+		if n.SizeDelta != 0 {
+			n.Text += fmt.Sprintf(", package size %+d bytes", n.SizeDelta)
+		}
+	}
+	tmpl := args.notifyTemplate
+	if tmpl == nil {
+		tmpl = template.Must(loadNotifyTemplate(""))
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, n); err != nil {
+		return fmt.Errorf("notification payload template: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, args.notifyURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
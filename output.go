@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// runResult is the -json output of a single run
+type runResult struct {
+	Function string         `json:"function"`
+	Targets  []targetResult `json:"targets"`
+	Duration float64        `json:"durationSeconds"`
+}
+
+// targetResult is the outcome of publishing to a single target
+type targetResult struct {
+	Target      string  `json:"target"` // account/region
+	FunctionArn string  `json:"functionArn,omitempty"`
+	Version     string  `json:"version,omitempty"` // empty if nothing was published
+	CodeSha256  string  `json:"codeSha256,omitempty"`
+	FunctionURL string  `json:"functionUrl,omitempty"`
+	PackageSize int     `json:"packageSize,omitempty"`
+	Published   bool    `json:"published"`
+	Error       string  `json:"error,omitempty"`
+	Build       float64 `json:"buildSeconds"`
+	Publish     float64 `json:"publishSeconds"`
+}
+
+// writeResult writes JSON document describing the outcome of publishing to
+// the targets as a single line
+func writeResult(w io.Writer, name string, start time.Time, targets []*target) error {
+	res := runResult{Function: name, Duration: time.Since(start).Seconds()}
+	for _, t := range targets {
+		res.Targets = append(res.Targets, t.result())
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// result returns the outcome of publishing to the target
+func (t *target) result() targetResult {
+	r := targetResult{
+		Target:      t.where(),
+		Version:     t.version,
+		CodeSha256:  t.codeSha256,
+		FunctionURL: t.functionURL,
+		PackageSize: int(t.pkg.len()),
+		Published:   t.version != "",
+		Build:       t.buildTime.Seconds(),
+		Publish:     t.publishTime.Seconds(),
+	}
+	if t.cfg != nil {
+		r.FunctionArn = t.unqualifiedArn()
+		if t.version != "" {
+			r.FunctionArn += ":" + t.version
+		}
+	}
+	if t.err != nil {
+		r.Error = t.err.Error()
+	}
+	return r
+}
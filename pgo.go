@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// resolvePGO resolves -pgo flag value to the profile to build with,
+// downloading it to tdir if it is an s3:// URL. It returns go build -pgo
+// value, and a description of the profile to record in the version
+// description, empty if PGO is not used.
+//
+// For the default "auto" value, profile is default.pgo in the main package
+// directory, if it exists, same as go build does.
+func resolvePGO(ctx context.Context, cfg aws.Config, pgo, dir, tdir string) (flagValue, desc string, err error) {
+	var name string
+	switch {
+	case pgo == "off":
+		return "off", "", nil
+	case pgo == "auto" || pgo == "":
+		name = filepath.Join(dir, "default.pgo")
+		if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			return "", "", nil
+		}
+		desc = "default.pgo"
+	case strings.HasPrefix(pgo, "s3://"):
+		if name, err = downloadS3(ctx, cfg, pgo, filepath.Join(tdir, "default.pgo")); err != nil {
+			return "", "", fmt.Errorf("downloading PGO profile: %w", err)
+		}
+		desc = pgo
+	default:
+		name, desc = pgo, filepath.Base(pgo)
+	}
+	if name, err = filepath.Abs(name); err != nil {
+		return "", "", err
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", "", fmt.Errorf("reading PGO profile: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return name, "built with PGO profile " + desc + " (sha256 " + hex.EncodeToString(sum[:6]) + ")", nil
+}
+
+// downloadS3 saves object at s3://bucket/key URL to file dst, returning dst
+func downloadS3(ctx context.Context, cfg aws.Config, s3url, dst string) (string, error) {
+	u, err := url.Parse(s3url)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return "", fmt.Errorf("invalid S3 URL %q, want s3://bucket/key", s3url)
+	}
+	out, err := newS3Client(cfg).GetObject(ctx, &s3.GetObjectInput{Bucket: &u.Host, Key: &key})
+	if err != nil {
+		return "", fmt.Errorf("S3 GetObject: %w", err)
+	}
+	defer out.Body.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, out.Body); err != nil {
+		return "", err
+	}
+	return dst, f.Close()
+}
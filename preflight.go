@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runTests runs tests of all packages in dir and below, for the host
+// platform
+func runTests(ctx context.Context, dir string, tags []string) error {
+	cmd := exec.CommandContext(ctx, "go", "test", "-tags="+strings.Join(tags, ","), "./...")
+	cmd.Dir = dir
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tests failed: %w", err)
+	}
+	return nil
+}
+
+// vulncheck runs govulncheck on the package in dir, analyzing code the same
+// way it is built for Lambda. It returns an error if govulncheck finds
+// reachable vulnerabilities, unless warnOnly is set, in which case findings
+// are only logged. If govulncheck is not installed, it is run with go run.
+func vulncheck(ctx context.Context, dir, arch string, tags []string, warnOnly bool) error {
+	args := []string{"-tags=" + strings.Join(tags, ","), "."}
+	cmd := exec.CommandContext(ctx, "govulncheck", args...)
+	if _, err := exec.LookPath("govulncheck"); err != nil {
+		cmd = exec.CommandContext(ctx, "go", append([]string{"run", "golang.org/x/vuln/cmd/govulncheck@latest"}, args...)...)
+	}
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	// govulncheck exits with code 3 when it finds vulnerabilities
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 3 {
+		if warnOnly {
+			slog.Warn("govulncheck found vulnerabilities, publishing anyway")
+			return nil
+		}
+		return errors.New("govulncheck found vulnerabilities")
+	}
+	if err != nil {
+		return fmt.Errorf("govulncheck: %w", err)
+	}
+	return nil
+}
+
+// lint runs go vet, and staticcheck if it is installed, on the packages in
+// dir and below, for linux and the given arch, returning an error if either
+// reports any issues
+func lint(ctx context.Context, dir, arch string, tags []string) error {
+	tagsArg := "-tags=" + strings.Join(tags, ",")
+	cmds := []*exec.Cmd{exec.CommandContext(ctx, "go", "vet", tagsArg, "./...")}
+	if _, err := exec.LookPath("staticcheck"); err == nil {
+		cmds = append(cmds, exec.CommandContext(ctx, "staticcheck", tagsArg, "./..."))
+	}
+	for _, cmd := range cmds {
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(cmd.Path), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	provenanceSuffix = ".intoto.json"
+	inTotoPayload    = "application/vnd.in-toto+json"
+	slsaProvenance   = "https://slsa.dev/provenance/v1"
+	buildType        = "https://github.com/artyom/publish-go-lambda/build/v1"
+)
+
+// inTotoStatement is the in-toto attestation statement with the SLSA
+// provenance predicate, see https://slsa.dev/spec/v1.0/provenance
+type inTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []resourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     struct {
+		BuildDefinition struct {
+			BuildType            string               `json:"buildType"`
+			ExternalParameters   map[string]any       `json:"externalParameters"`
+			InternalParameters   map[string]any       `json:"internalParameters,omitempty"`
+			ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies,omitempty"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID      string            `json:"id"`
+				Version map[string]string `json:"version,omitempty"`
+			} `json:"builder"`
+			Metadata struct {
+				InvocationID string `json:"invocationId,omitempty"`
+				StartedOn    string `json:"startedOn"`
+				FinishedOn   string `json:"finishedOn"`
+			} `json:"metadata"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+type resourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// dsseEnvelope is the signed envelope of the statement, see
+// https://github.com/secure-systems-lab/dsse
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     []byte          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of the payload, which
+// is what is signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
+
+// loadSigningKey loads the PEM-encoded PKCS #8 Ed25519 or ECDSA private key
+// to sign provenance with
+func loadSigningKey(name string) (crypto.Signer, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM-encoded PKCS #8 private key found", name)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported %T key, want Ed25519 or ECDSA", name, key)
+}
+
+// keyID returns the hex-encoded SHA-256 of the DER-encoded public key
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeProvenance stores the signed provenance of the t.version build
+func (t *target) writeProvenance(ctx context.Context, args *runArgs) error {
+	rec, err := t.deployRecord(ctx)
+	if err != nil {
+		return err
+	}
+	sum, err := base64.StdEncoding.DecodeString(rec.CodeSha256)
+	if err != nil {
+		return fmt.Errorf("decoding CodeSha256 of the version: %w", err)
+	}
+	var st inTotoStatement
+	st.Type, st.PredicateType = "https://in-toto.io/Statement/v1", slsaProvenance
+	st.Subject = []resourceDescriptor{{Name: rec.Function, Digest: map[string]string{"sha256": hex.EncodeToString(sum)}}}
+	bd := &st.Predicate.BuildDefinition
+	bd.BuildType = buildType
+	bd.ExternalParameters = map[string]any{"package": args.dir}
+	if len(args.tags) != 0 {
+		bd.ExternalParameters["tags"] = args.tags
+	}
+	bd.InternalParameters = map[string]any{"arch": t.arch, "binary": t.binaryName}
+	if t.deploy.commit != "" {
+		source := resourceDescriptor{Digest: map[string]string{"gitCommit": t.deploy.commit}}
+		if t.deploy.remote != "" {
+			source.URI = "git+" + t.deploy.remote
+			if t.deploy.branch != "" {
+				source.URI += "@refs/heads/" + t.deploy.branch
+			}
+		}
+		bd.ExternalParameters["source"] = source
+		bd.ResolvedDependencies = append(bd.ResolvedDependencies, source)
+		if t.deploy.dirty {
+			bd.InternalParameters["dirty"] = true
+		}
+	}
+	if bi := t.buildInfo; bi != nil {
+		bd.ResolvedDependencies = append(bd.ResolvedDependencies, resourceDescriptor{URI: "pkg:golang/stdlib@" + bi.GoVersion})
+		for _, m := range bi.Deps {
+			if m.Replace != nil {
+				m = m.Replace
+			}
+			d := resourceDescriptor{URI: "pkg:golang/" + m.Path + "@" + m.Version}
+			if sum, ok := strings.CutPrefix(m.Sum, "h1:"); ok {
+				d.Digest = map[string]string{"dirHash1": sum}
+			}
+			bd.ResolvedDependencies = append(bd.ResolvedDependencies, d)
+		}
+	}
+	rd := &st.Predicate.RunDetails
+	rd.Builder.ID = rec.Caller
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		rd.Builder.Version = map[string]string{"publish-go-lambda": bi.Main.Version}
+	}
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		rd.Metadata.InvocationID = os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY") +
+			"/actions/runs/" + os.Getenv("GITHUB_RUN_ID") + "/attempts/" + os.Getenv("GITHUB_RUN_ATTEMPT")
+	}
+	rd.Metadata.StartedOn = rec.Start.UTC().Format(time.RFC3339)
+	rd.Metadata.FinishedOn = time.Now().UTC().Format(time.RFC3339)
+
+	env := dsseEnvelope{PayloadType: inTotoPayload}
+	if env.Payload, err = json.Marshal(&st); err != nil {
+		return err
+	}
+	sig := dsseSignature{}
+	if sig.KeyID, err = keyID(args.provenanceKey.Public()); err != nil {
+		return err
+	}
+	if sig.Sig, err = signPAE(args.provenanceKey, dssePAE(env.PayloadType, env.Payload)); err != nil {
+		return fmt.Errorf("signing provenance: %w", err)
+	}
+	env.Signatures = []dsseSignature{sig}
+	body, err := json.Marshal(&env)
+	if err != nil {
+		return err
+	}
+	s := args.provenance
+	key := s.key(rec.Function, t.version, provenanceSuffix)
+	if _, err := newS3Client(s.cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/vnd.dsse.envelope.v1+json"),
+	}); err != nil {
+		return fmt.Errorf("S3 PutObject: %w", err)
+	}
+	t.debugf("wrote provenance to s3://%s/%s", s.bucket, key)
+	return nil
+}
+
+// signPAE signs the pre-authentication encoding: Ed25519 keys sign it as is,
+// ECDSA keys sign its SHA-256
+func signPAE(key crypto.Signer, pae []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, pae, crypto.Hash(0))
+	}
+	sum := sha256.Sum256(pae)
+	return key.Sign(rand.Reader, sum[:], crypto.SHA256)
+}
+
+// verifyPAE reports whether sig is a valid signature of the pre-authentication
+// encoding made with the private key of pub
+func verifyPAE(pub crypto.PublicKey, pae, sig []byte) bool {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, pae, sig)
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(pae)
+		return ecdsa.VerifyASN1(pub, sum[:], sig)
+	}
+	return false
+}
+
+func verifyCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	location := fs.String("location", "", "s3://bucket/prefix/ `URL` provenance was written to with -provenance flag")
+	keyFile := fs.String("key", "", "PEM-encoded public key `file` matching the -provenance-key private key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s verify -location s3://bucket/prefix/ -key public.pem aws-lambda-name:version\n\n",
+			filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Verifies the signed provenance of the published function version, or the version\n"+
+			"alias points to, written on publish with -provenance flag, and that it describes the\n"+
+			"code the version runs. Prints the git commit and the builder identity it was built by.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name, qualifier := splitQualifier(fs.Arg(0))
+	if name == "" || qualifier == "" {
+		return withExitCode(exitInvalid, errors.New("name with version or alias must be set, like my-function:42"))
+	}
+	store, err := parseVersionStore(*location)
+	if err != nil {
+		return withExitCode(exitInvalid, fmt.Errorf("-location: %w", err))
+	}
+	pub, err := loadPublicKey(*keyFile)
+	if err != nil {
+		return withExitCode(exitInvalid, fmt.Errorf("-key: %w", err))
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	fn, err := lambda.NewFromConfig(cfg).GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &name,
+		Qualifier:    &qualifier,
+	})
+	if err != nil {
+		return fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	key := store.key(aws.ToString(fn.FunctionArn), aws.ToString(fn.Version), provenanceSuffix)
+	out, err := newS3Client(cfg).GetObject(ctx, &s3.GetObjectInput{Bucket: &store.bucket, Key: &key})
+	if err != nil {
+		return fmt.Errorf("S3 GetObject s3://%s/%s: %w", store.bucket, key, err)
+	}
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		return err
+	}
+	st, err := verifyProvenance(body, pub, aws.ToString(fn.CodeSha256))
+	if err != nil {
+		return withExitCode(exitInvalid, fmt.Errorf("s3://%s/%s: %w", store.bucket, key, err))
+	}
+	fmt.Printf("function:\t%s\n", st.Subject[0].Name)
+	if source, _ := st.Predicate.BuildDefinition.ExternalParameters["source"].(map[string]any); source != nil {
+		uri, _ := source["uri"].(string)
+		digest, _ := source["digest"].(map[string]any)
+		commit, _ := digest["gitCommit"].(string)
+		fmt.Printf("source:\t%s\ncommit:\t%s\n", uri, commit)
+	}
+	if dirty, _ := st.Predicate.BuildDefinition.InternalParameters["dirty"].(bool); dirty {
+		fmt.Println("dirty:\ttrue")
+	}
+	fmt.Printf("builder:\t%s\n", st.Predicate.RunDetails.Builder.ID)
+	if id := st.Predicate.RunDetails.Metadata.InvocationID; id != "" {
+		fmt.Printf("invocation:\t%s\n", id)
+	}
+	fmt.Printf("built:\t%s\n", st.Predicate.RunDetails.Metadata.StartedOn)
+	return nil
+}
+
+// verifyProvenance checks that the DSSE envelope is signed with the private
+// key of pub, and that the provenance statement it holds is for the code
+// with codeSha256, the base64-encoded SHA-256 Lambda reports
+func verifyProvenance(envelope []byte, pub crypto.PublicKey, codeSha256 string) (*inTotoStatement, error) {
+	var env dsseEnvelope
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		return nil, fmt.Errorf("decoding envelope: %w", err)
+	}
+	if env.PayloadType != inTotoPayload {
+		return nil, fmt.Errorf("unexpected payload type %q", env.PayloadType)
+	}
+	pae := dssePAE(env.PayloadType, env.Payload)
+	var signed bool
+	for _, sig := range env.Signatures {
+		if verifyPAE(pub, pae, sig.Sig) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return nil, errors.New("provenance is not signed with the given key")
+	}
+	var st inTotoStatement
+	if err := json.Unmarshal(env.Payload, &st); err != nil {
+		return nil, fmt.Errorf("decoding statement: %w", err)
+	}
+	if st.PredicateType != slsaProvenance || st.Predicate.BuildDefinition.BuildType != buildType {
+		return nil, fmt.Errorf("unexpected predicate type %q or build type %q",
+			st.PredicateType, st.Predicate.BuildDefinition.BuildType)
+	}
+	sum, err := base64.StdEncoding.DecodeString(codeSha256)
+	if err != nil {
+		return nil, fmt.Errorf("decoding CodeSha256 of the version: %w", err)
+	}
+	if len(st.Subject) != 1 || st.Subject[0].Digest["sha256"] != hex.EncodeToString(sum) {
+		return nil, errors.New("provenance is for a different code than the function version runs")
+	}
+	return &st, nil
+}
+
+// loadPublicKey loads the PEM-encoded PKIX Ed25519 or ECDSA public key
+func loadPublicKey(name string) (crypto.PublicKey, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: no PEM-encoded public key found", name)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
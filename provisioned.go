@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// provision configures n provisioned concurrent executions for the version
+// and waits up to timeout until they are allocated, so that traffic is only
+// shifted to the version once it can serve it without cold starts. If
+// allocation fails, provisioned concurrency configuration is removed.
+func (t *target) provision(ctx context.Context, version string, n int32, timeout time.Duration) error {
+	t.logf("provisioning %d concurrent executions for version %s", n, version)
+	if _, err := t.svc.PutProvisionedConcurrencyConfig(ctx, &lambda.PutProvisionedConcurrencyConfigInput{
+		FunctionName:                    &t.name,
+		Qualifier:                       &version,
+		ProvisionedConcurrentExecutions: &n,
+	}); err != nil {
+		return fmt.Errorf("PutProvisionedConcurrencyConfig: %w", err)
+	}
+	err := t.waitProvisioned(ctx, version, timeout)
+	if err == nil {
+		return nil
+	}
+	// provisioned concurrency is billed for even if it is not used
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if _, derr := t.svc.DeleteProvisionedConcurrencyConfig(ctx, &lambda.DeleteProvisionedConcurrencyConfigInput{
+		FunctionName: &t.name,
+		Qualifier:    &version,
+	}); derr != nil {
+		return fmt.Errorf("%w; removing provisioned concurrency configuration failed: %w", err, derr)
+	}
+	return err
+}
+
+// waitProvisioned polls provisioned concurrency configuration of the version
+// until it is READY, or until it fails or timeout expires, returning an error
+// then
+func (t *target) waitProvisioned(ctx context.Context, version string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for provisioned concurrency to become ready: %w", ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+		out, err := t.svc.GetProvisionedConcurrencyConfig(ctx, &lambda.GetProvisionedConcurrencyConfigInput{
+			FunctionName: &t.name,
+			Qualifier:    &version,
+		})
+		if err != nil {
+			return fmt.Errorf("GetProvisionedConcurrencyConfig: %w", err)
+		}
+		switch out.Status {
+		case types.ProvisionedConcurrencyStatusEnumReady:
+			t.logf("provisioned concurrency of version %s is ready", version)
+			return nil
+		case types.ProvisionedConcurrencyStatusEnumFailed:
+			return fmt.Errorf("provisioned concurrency allocation failed: %s", aws.ToString(out.StatusReason))
+		}
+		t.debugf("provisioned concurrency is %s, %d of %d executions allocated", out.Status,
+			aws.ToInt32(out.AllocatedProvisionedConcurrentExecutions), aws.ToInt32(out.RequestedProvisionedConcurrentExecutions))
+	}
+}
+
+// releaseProvisioned removes provisioned concurrency configuration of the
+// function versions no alias routes traffic to anymore, like the ones aliases
+// pointed to before the deploy. Version keep is never released.
+func (t *target) releaseProvisioned(ctx context.Context, keep string) error {
+	aliases, err := versionAliases(ctx, t.svc, t.name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	p := lambda.NewListProvisionedConcurrencyConfigsPaginator(t.svc, &lambda.ListProvisionedConcurrencyConfigsInput{
+		FunctionName: &t.name,
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("ListProvisionedConcurrencyConfigs: %w", err)
+		}
+		for _, c := range page.ProvisionedConcurrencyConfigs {
+			arn := aws.ToString(c.FunctionArn)
+			version := arn[strings.LastIndexByte(arn, ':')+1:]
+			if _, err := strconv.Atoi(version); err != nil || version == keep || len(aliases[version]) != 0 {
+				continue // alias, or version still in use
+			}
+			if _, err := t.svc.DeleteProvisionedConcurrencyConfig(ctx, &lambda.DeleteProvisionedConcurrencyConfigInput{
+				FunctionName: &t.name,
+				Qualifier:    &version,
+			}); err != nil {
+				errs = append(errs, fmt.Errorf("DeleteProvisionedConcurrencyConfig of version %s: %w", version, err))
+				continue
+			}
+			t.logf("released provisioned concurrency of retired version %s", version)
+		}
+	}
+	return errors.Join(errs...)
+}
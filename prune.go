@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/smithy-go"
+)
+
+func pruneCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	keep := fs.Int("keep", 10, "always keep this `number` of the most recent versions")
+	olderThan := fs.Duration("older-than", 0, "only delete versions published more than this `duration` ago")
+	dryRun := fs.Bool("dry-run", false, "only list versions that would be deleted")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s prune [flags] aws-lambda-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Deletes old published versions. Versions referenced by aliases or\n"+
+			"event source mappings are never deleted.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("name must be set"))
+	}
+	if *keep < 0 {
+		return errors.New("-keep cannot be negative")
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	svc := lambda.NewFromConfig(cfg)
+	candidates, err := pruneCandidates(ctx, svc, name, *keep, *olderThan)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		slog.Info("nothing to prune")
+		return nil
+	}
+	for _, v := range candidates {
+		if *dryRun {
+			slog.Info("would delete version " + v)
+			continue
+		}
+		if _, err := svc.DeleteFunction(ctx, &lambda.DeleteFunctionInput{FunctionName: &name, Qualifier: &v}); err != nil {
+			return fmt.Errorf("deleting version %s: %w", v, err)
+		}
+		slog.Info("deleted version " + v)
+	}
+	return nil
+}
+
+// pruneCandidates returns published versions that are not among the keep most
+// recent ones, were published more than olderThan ago (if it is positive), and
+// are not referenced by any alias or event source mapping.
+func pruneCandidates(ctx context.Context, svc *lambda.Client, name string, keep int, olderThan time.Duration) ([]string, error) {
+	versions, err := publishedVersions(ctx, svc, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) <= keep {
+		return nil, nil
+	}
+	versions = versions[:len(versions)-keep]
+	inUse, err := versionAliases(ctx, svc, name)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := mappedVersions(ctx, svc, name)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var out []string
+	for _, v := range versions {
+		version := aws.ToString(v.Version)
+		if _, ok := inUse[version]; ok {
+			continue
+		}
+		if _, ok := mapped[version]; ok {
+			continue
+		}
+		if olderThan > 0 {
+			published, err := time.Parse(lastModifiedLayout, aws.ToString(v.LastModified))
+			if err != nil {
+				return nil, fmt.Errorf("version %s: %w", version, err)
+			}
+			if published.After(cutoff) {
+				continue
+			}
+		}
+		out = append(out, version)
+	}
+	return out, nil
+}
+
+// mappedVersions returns set of function versions that event source mappings
+// point to
+func mappedVersions(ctx context.Context, svc *lambda.Client, name string) (map[string]struct{}, error) {
+	fn, err := svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{FunctionName: &name})
+	if err != nil {
+		return nil, fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	prefix := aws.ToString(fn.FunctionArn) + ":"
+	out := make(map[string]struct{})
+	// listing is not filtered by function name, as such filter may not match
+	// mappings pointing to qualified function ARNs
+	p := lambda.NewListEventSourceMappingsPaginator(svc, &lambda.ListEventSourceMappingsInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListEventSourceMappings: %w", err)
+		}
+		for _, m := range page.EventSourceMappings {
+			if qualifier, ok := strings.CutPrefix(aws.ToString(m.FunctionArn), prefix); ok {
+				out[qualifier] = struct{}{}
+			}
+		}
+	}
+	return out, nil
+}
+
+// lastModifiedLayout is the time format of the function LastModified field
+const lastModifiedLayout = "2006-01-02T15:04:05.000-0700"
+
+// codeStorageThreshold is the share of the account code storage quota, past
+// which publishing warns about it
+const codeStorageThreshold = 0.9
+
+// codeStorage is the account code storage usage by role and region, so
+// that it is only fetched once for all targets using them. Usage includes
+// the packages of the targets checked so far.
+type codeStorage map[string]*codeStorageUsage
+
+type codeStorageUsage struct {
+	limit int64
+	used  int64
+}
+
+// checkCodeStorage warns if publishing the package gets the account code
+// storage usage of the region over codeStorageThreshold of the quota, as
+// once the quota is reached, no more versions can be published. It sets
+// t.nearQuota, so that with -prune-keep old versions are pruned after the
+// publish. The check is advisory: if usage cannot be fetched, it is skipped.
+func (t *target) checkCodeStorage(ctx context.Context, storage codeStorage) {
+	key := t.role + "|" + t.awsCfg.Region
+	u, ok := storage[key]
+	if !ok {
+		u = t.codeStorageUsage(ctx)
+		storage[key] = u
+	}
+	if u == nil {
+		return
+	}
+	u.used += t.pkg.len()
+	if float64(u.used) < codeStorageThreshold*float64(u.limit) {
+		return
+	}
+	t.nearQuota = true
+	t.warnf("account code storage in %s would be %.1f%% used (%s of %s) after publishing, use prune subcommand"+
+		" or -prune-keep flag to delete old versions", t.awsCfg.Region, 100*float64(u.used)/float64(u.limit),
+		sizeString(u.used), sizeString(u.limit))
+}
+
+// codeStorageUsage returns the account code storage usage of the region,
+// or nil if it is not available
+func (t *target) codeStorageUsage(ctx context.Context) *codeStorageUsage {
+	out, err := t.svc.GetAccountSettings(ctx, &lambda.GetAccountSettingsInput{})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDeniedException" {
+		t.debugf("not checking code storage usage: %v", err)
+		return nil
+	}
+	if err != nil {
+		t.warnf("not checking code storage usage: GetAccountSettings: %v", err)
+		return nil
+	}
+	if out.AccountLimit == nil || out.AccountUsage == nil || out.AccountLimit.TotalCodeSize == 0 {
+		return nil
+	}
+	return &codeStorageUsage{limit: out.AccountLimit.TotalCodeSize, used: out.AccountUsage.TotalCodeSize}
+}
+
+// pruneVersions deletes old versions of the function once it is published,
+// keeping the given number of the most recent ones
+func (t *target) pruneVersions(ctx context.Context, keep int) error {
+	candidates, err := pruneCandidates(ctx, t.svc, t.name, keep, 0)
+	if err != nil {
+		return err
+	}
+	for _, v := range candidates {
+		if _, err := t.svc.DeleteFunction(ctx, &lambda.DeleteFunctionInput{FunctionName: &t.name, Qualifier: &v}); err != nil {
+			return fmt.Errorf("deleting version %s: %w", v, err)
+		}
+		t.logf("deleted version %s", v)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// asyncInvokers are the service principals that invoke functions
+// asynchronously, so that failed events are lost unless the function has a
+// dead-letter queue or an on-failure destination
+var asyncInvokers = []string{
+	"s3.amazonaws.com",
+	"sns.amazonaws.com",
+	"events.amazonaws.com",
+	"ses.amazonaws.com",
+	"iot.amazonaws.com",
+	"logs.amazonaws.com",
+	"config.amazonaws.com",
+	"cloudformation.amazonaws.com",
+	"codecommit.amazonaws.com",
+}
+
+// checkFailureDestination reports whether the function that AWS services are
+// allowed to invoke asynchronously has somewhere to send the events it
+// failed to process: a dead-letter queue, or on-failure destination of the
+// -alias (or unqualified function) it is invoked through. It returns an error
+// if args.strictReliability is set, and only logs a warning otherwise.
+func (t *target) checkFailureDestination(ctx context.Context, args *runArgs) error {
+	if t.cfg == nil {
+		return nil // to be created
+	}
+	if t.cfg.DeadLetterConfig != nil && aws.ToString(t.cfg.DeadLetterConfig.TargetArn) != "" {
+		return nil
+	}
+	err := t.failureDestinationErr(ctx, args)
+	if err == nil || args.strictReliability {
+		return err
+	}
+	t.warnf("%v", err)
+	return nil
+}
+
+// failureDestinationErr does the checkFailureDestination checks that need
+// API calls
+func (t *target) failureDestinationErr(ctx context.Context, args *runArgs) error {
+	var qualifier *string
+	if args.alias != "" {
+		qualifier = &args.alias
+	}
+	invoker, err := t.asyncInvoker(ctx, qualifier)
+	if err != nil || invoker == "" {
+		return err
+	}
+	out, err := t.svc.GetFunctionEventInvokeConfig(ctx, &lambda.GetFunctionEventInvokeConfigInput{
+		FunctionName: &t.name,
+		Qualifier:    qualifier,
+	})
+	var notFound *types.ResourceNotFoundException
+	switch {
+	case errors.As(err, &notFound):
+	case err != nil:
+		return fmt.Errorf("GetFunctionEventInvokeConfig: %w", err)
+	case out.DestinationConfig != nil && out.DestinationConfig.OnFailure != nil &&
+		aws.ToString(out.DestinationConfig.OnFailure.Destination) != "":
+		return nil
+	}
+	return fmt.Errorf("function can be invoked asynchronously by %s, but has neither a dead-letter queue,"+
+		" nor an on-failure destination, so events it fails to process are lost", invoker)
+}
+
+// asyncInvoker returns the first of asyncInvokers resource-based policy of
+// the function allows to invoke it, or an empty string if there are none
+func (t *target) asyncInvoker(ctx context.Context, qualifier *string) (string, error) {
+	out, err := t.svc.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: &t.name, Qualifier: qualifier})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("GetPolicy: %w", err)
+	}
+	var policy struct {
+		Statement []struct {
+			Effect    string
+			Principal json.RawMessage // either "*", or an object
+		}
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(out.Policy)), &policy); err != nil {
+		return "", fmt.Errorf("parsing function policy: %w", err)
+	}
+	for _, st := range policy.Statement {
+		if st.Effect != "Allow" {
+			continue
+		}
+		var principal struct{ Service stringList }
+		if json.Unmarshal(st.Principal, &principal) != nil {
+			continue
+		}
+		for _, s := range principal.Service {
+			if slices.Contains(asyncInvokers, s) {
+				return s, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// stringList is a policy element that is either a single string or a list of
+// strings
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = []string{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(l))
+}
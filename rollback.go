@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+func rollbackCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	alias := fs.String("alias", "", "point this `alias` to the previous version, instead of re-publishing previous code")
+	version := fs.String("version", "", "roll back to this `version` instead of the previous one")
+	timeout := fs.Duration("timeout", 5*time.Minute, "limit on the `duration` of re-publishing previous code")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s rollback [flags] aws-lambda-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Re-publishes code of the previous version, or, if -alias is set,\n"+
+			"points alias to the version published before the one it currently points to.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("name must be set"))
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	svc := lambda.NewFromConfig(cfg)
+	if *alias != "" {
+		return rollbackAlias(ctx, svc, name, *alias, *version)
+	}
+	cfgOutput, err := svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &name,
+		Qualifier:    aws.String("$LATEST"),
+	})
+	if err != nil {
+		return fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	target := *version
+	if target == "" {
+		versions, err := publishedVersions(ctx, svc, name)
+		if err != nil {
+			return err
+		}
+		// current version is the latest one published with $LATEST code
+		var current string
+		for _, v := range versions {
+			if aws.ToString(v.CodeSha256) == aws.ToString(cfgOutput.CodeSha256) {
+				current = aws.ToString(v.Version)
+			}
+		}
+		if target, err = previousVersion(versions, current, aws.ToString(cfgOutput.CodeSha256)); err != nil {
+			return err
+		}
+	}
+	newVersion, err := republish(ctx, svc, name, target, cfgOutput.RevisionId, *timeout)
+	if err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("code of version %s re-published as version %s", target, newVersion))
+	return nil
+}
+
+// rollbackAlias points alias to the given version, or, if version is empty,
+// to the version published before the one alias currently points to
+func rollbackAlias(ctx context.Context, svc *lambda.Client, name, alias, version string) error {
+	cur, err := svc.GetAlias(ctx, &lambda.GetAliasInput{FunctionName: &name, Name: &alias})
+	if err != nil {
+		return fmt.Errorf("GetAlias: %w", err)
+	}
+	if version == "" {
+		versions, err := publishedVersions(ctx, svc, name)
+		if err != nil {
+			return err
+		}
+		var curSha string
+		for _, v := range versions {
+			if aws.ToString(v.Version) == aws.ToString(cur.FunctionVersion) {
+				curSha = aws.ToString(v.CodeSha256)
+			}
+		}
+		if version, err = previousVersion(versions, aws.ToString(cur.FunctionVersion), curSha); err != nil {
+			return err
+		}
+	}
+	_, err = svc.UpdateAlias(ctx, &lambda.UpdateAliasInput{
+		FunctionName:    &name,
+		Name:            &alias,
+		FunctionVersion: &version,
+		RevisionId:      cur.RevisionId,
+		RoutingConfig:   &types.AliasRoutingConfiguration{AdditionalVersionWeights: map[string]float64{}},
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateAlias: %w", err)
+	}
+	slog.Info(fmt.Sprintf("alias %s now points to version %s (was %s)", alias, version, aws.ToString(cur.FunctionVersion)))
+	return nil
+}
+
+// republish downloads code of the published function version and uploads it
+// as the new $LATEST code, publishing a new version, within timeout. Function
+// is switched back to the architecture of the version too, as the code may
+// have been published for the other one since. It returns the number of the
+// newly published version.
+func republish(ctx context.Context, svc *lambda.Client, name, version string, revisionID *string,
+	timeout time.Duration) (string, error) {
+	fn, err := svc.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: &name, Qualifier: &version})
+	if err != nil {
+		return "", fmt.Errorf("GetFunction: %w", err)
+	}
+	if fn.Configuration != nil && fn.Configuration.PackageType != types.PackageTypeZip {
+		return "", fmt.Errorf("only ZIP type packaged Lambdas supported, but this one is deployed as %v", fn.Configuration.PackageType)
+	}
+	if fn.Code == nil || fn.Code.Location == nil {
+		return "", fmt.Errorf("no code location for version %s", version)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	zipData, err := download(ctx, *fn.Code.Location)
+	if err != nil {
+		return "", fmt.Errorf("downloading code of version %s: %w", version, err)
+	}
+	in := &lambda.UpdateFunctionCodeInput{
+		FunctionName: &name,
+		RevisionId:   revisionID,
+		ZipFile:      zipData,
+		Publish:      true,
+	}
+	if fn.Configuration != nil {
+		in.Architectures = fn.Configuration.Architectures
+	}
+	out, err := svc.UpdateFunctionCode(ctx, in)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Version), nil
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// restoreCode re-publishes code the function had before the target was
+// published, it is called after the failed deploy with the reason of failure.
+// Reserved concurrency changed by the deploy is restored too, all within
+// timeout. It always returns a non-nil error.
+func (t *target) restoreCode(ctx context.Context, reason error, timeout time.Duration) error {
+	// parent context may be already canceled, but code still must be restored
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	if err := t.restoreConcurrency(ctx); err != nil {
+		t.warnf("restoring reserved concurrency: %v", err)
+	}
+	versions, err := publishedVersions(ctx, t.svc, t.name)
+	if err != nil {
+		return fmt.Errorf("%w; restoring previous code failed: %w", reason, err)
+	}
+	var prev string
+	for _, v := range versions {
+		if aws.ToString(v.CodeSha256) == aws.ToString(t.cfg.CodeSha256) {
+			prev = aws.ToString(v.Version)
+		}
+	}
+	if prev == "" {
+		return fmt.Errorf("%w; cannot restore previous code: no published version has it", reason)
+	}
+	newVersion, err := republish(ctx, t.svc, t.name, prev, nil, timeout)
+	if err != nil {
+		return fmt.Errorf("%w; restoring previous code failed: %w", reason, err)
+	}
+	t.logf("code of version %s re-published as version %s", prev, newVersion)
+	return fmt.Errorf("%w; previous code restored", reason)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// runtimeUpdate is the runtime management configuration set with
+// -runtime-update flag
+type runtimeUpdate struct {
+	mode    types.UpdateRuntimeOn
+	version string // runtime version ARN for the Manual mode
+}
+
+// parseRuntimeUpdate parses -runtime-update flag value: auto,
+// function-update, or manual:ARN
+func parseRuntimeUpdate(s string) (*runtimeUpdate, error) {
+	switch mode, version, _ := strings.Cut(s, ":"); mode {
+	case "auto":
+		return &runtimeUpdate{mode: types.UpdateRuntimeOnAuto}, nil
+	case "function-update":
+		return &runtimeUpdate{mode: types.UpdateRuntimeOnFunctionUpdate}, nil
+	case "manual":
+		if _, err := arn.Parse(version); err != nil {
+			return nil, fmt.Errorf("manual mode needs runtime version ARN, like manual:arn:aws:lambda:...: %w", err)
+		}
+		return &runtimeUpdate{mode: types.UpdateRuntimeOnManual, version: version}, nil
+	}
+	return nil, fmt.Errorf("unsupported mode %q, want auto, function-update, or manual:ARN", s)
+}
+
+// syncRuntimeUpdate sets runtime management configuration of the function
+// $LATEST version to args.runtimeUpdate, if it differs, so that the
+// published version uses it. If function runtime is pinned to a version
+// with the Manual mode, it warns about it, as pinned version gets no
+// security patches.
+func (t *target) syncRuntimeUpdate(ctx context.Context, args *runArgs) error {
+	out, err := t.svc.GetRuntimeManagementConfig(ctx, &lambda.GetRuntimeManagementConfigInput{
+		FunctionName: &t.name,
+		Qualifier:    aws.String("$LATEST"),
+	})
+	if err != nil && args.runtimeUpdate == nil {
+		// only needed for the warning
+		t.debugf("GetRuntimeManagementConfig: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("GetRuntimeManagementConfig: %w", err)
+	}
+	mode, pinned := out.UpdateRuntimeOn, aws.ToString(out.RuntimeVersionArn)
+	if want := args.runtimeUpdate; want != nil && (want.mode != mode || want.version != pinned) {
+		switch {
+		case args.dryRun:
+			t.logf("dry run, would change runtime update mode from %s to %s", describeRuntimeUpdate(mode, pinned),
+				describeRuntimeUpdate(want.mode, want.version))
+		default:
+			t.logf("changing runtime update mode from %s to %s", describeRuntimeUpdate(mode, pinned),
+				describeRuntimeUpdate(want.mode, want.version))
+			in := &lambda.PutRuntimeManagementConfigInput{
+				FunctionName:    &t.name,
+				Qualifier:       aws.String("$LATEST"),
+				UpdateRuntimeOn: want.mode,
+			}
+			if want.version != "" {
+				in.RuntimeVersionArn = &want.version
+			}
+			if _, err := t.svc.PutRuntimeManagementConfig(ctx, in); err != nil {
+				return fmt.Errorf("PutRuntimeManagementConfig: %w", err)
+			}
+		}
+		mode, pinned = want.mode, want.version
+	}
+	if mode != types.UpdateRuntimeOnManual {
+		return nil
+	}
+	current := ""
+	if t.cfg.RuntimeVersionConfig != nil {
+		current = aws.ToString(t.cfg.RuntimeVersionConfig.RuntimeVersionArn)
+	}
+	if current != "" && current != pinned {
+		t.logf("function runtime version %s is going to be replaced with the pinned %s", current, pinned)
+	}
+	t.warnf("function runtime is pinned to version %s, which gets no security patches, and may be stale;"+
+		" use -runtime-update auto or function-update to let Lambda update it", pinned)
+	return nil
+}
+
+// describeRuntimeUpdate describes runtime update mode for logs
+func describeRuntimeUpdate(mode types.UpdateRuntimeOn, version string) string {
+	if mode == types.UpdateRuntimeOnManual {
+		return fmt.Sprintf("%s (%s)", mode, version)
+	}
+	return string(mode)
+}
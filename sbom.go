@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// versionStore keeps documents describing the published versions, like
+// SBOMs, as S3 objects under the prefix, one per version
+type versionStore struct {
+	cfg    aws.Config
+	bucket string
+	prefix string
+}
+
+// parseVersionStore parses s3://bucket/prefix/ URL of the versionStore
+func parseVersionStore(s string) (*versionStore, error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q, want s3://bucket/prefix/", s)
+	}
+	return &versionStore{bucket: bucket, prefix: prefix}, nil
+}
+
+// key returns the S3 key of the document with the suffix describing the
+// function version, given the function ARN with any qualifier
+func (s *versionStore) key(functionArn, version, suffix string) string {
+	// function ARN is arn:aws:lambda:region:account:function:name[:qualifier]
+	parts := strings.Split(functionArn, ":")
+	return s.prefix + strings.Join(parts[3:5], "/") + "/" + parts[6] + "/" + version + suffix
+}
+
+const sbomSuffix = ".cdx.json"
+
+// writeSBOM stores SBOM of the t.version build
+func (t *target) writeSBOM(ctx context.Context, s *versionStore) error {
+	if t.buildInfo == nil {
+		return nil // container image, or a binary without build information
+	}
+	rec, err := t.deployRecord(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := cycloneDX(t.buildInfo, rec)
+	if err != nil {
+		return err
+	}
+	key := s.key(rec.Function, t.version, sbomSuffix)
+	_, err = newS3Client(s.cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/vnd.cyclonedx+json"),
+	})
+	if err != nil {
+		return fmt.Errorf("S3 PutObject: %w", err)
+	}
+	t.debugf("wrote SBOM to s3://%s/%s", s.bucket, key)
+	return nil
+}
+
+// cycloneDX returns CycloneDX JSON SBOM of the binary with the build
+// information, listing the modules it is built from, with the build settings
+// and the deployed function version as properties
+func cycloneDX(bi *debug.BuildInfo, rec *deployRecord) ([]byte, error) {
+	type property struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type component struct {
+		Type       string     `json:"type"`
+		BOMRef     string     `json:"bom-ref"`
+		Name       string     `json:"name"`
+		Version    string     `json:"version,omitempty"`
+		PURL       string     `json:"purl"`
+		Properties []property `json:"properties,omitempty"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn,omitempty"`
+	}
+	module := func(typ string, m *debug.Module) component {
+		c := component{Type: typ, Name: m.Path, Version: m.Version}
+		if c.Version == "(devel)" {
+			c.Version = "" // main module built from the working tree
+		}
+		if r := m.Replace; r != nil {
+			c.Properties = append(c.Properties, property{"go:replacedModule", m.Path + "@" + m.Version})
+			c.Name, c.Version = r.Path, r.Version
+		}
+		c.PURL = "pkg:golang/" + c.Name
+		if c.Version != "" {
+			c.PURL += "@" + c.Version
+		}
+		c.BOMRef = c.PURL
+		return c
+	}
+	app := module("application", &bi.Main)
+	app.Properties = append(app.Properties, property{"go:package", bi.Path})
+	for _, s := range bi.Settings {
+		app.Properties = append(app.Properties, property{"go:build:" + s.Key, s.Value})
+	}
+	stdlib := component{Type: "library", Name: "stdlib", Version: bi.GoVersion, PURL: "pkg:golang/stdlib@" + bi.GoVersion}
+	stdlib.BOMRef = stdlib.PURL
+	components := []component{stdlib}
+	deps := dependency{Ref: app.BOMRef, DependsOn: []string{stdlib.BOMRef}}
+	for _, m := range bi.Deps {
+		c := module("library", m)
+		components = append(components, c)
+		deps.DependsOn = append(deps.DependsOn, c.BOMRef)
+	}
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	uuid[6], uuid[8] = uuid[6]&0x0f|0x40, uuid[8]&0x3f|0x80 // version 4, variant 1
+	doc := struct {
+		BOMFormat    string `json:"bomFormat"`
+		SpecVersion  string `json:"specVersion"`
+		SerialNumber string `json:"serialNumber"`
+		Version      int    `json:"version"`
+		Metadata     struct {
+			Timestamp string `json:"timestamp"`
+			Tools     struct {
+				Components []component `json:"components"`
+			} `json:"tools"`
+			Component  component  `json:"component"`
+			Properties []property `json:"properties"`
+		} `json:"metadata"`
+		Components   []component  `json:"components"`
+		Dependencies []dependency `json:"dependencies"`
+	}{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]),
+		Version:      1,
+		Components:   components,
+		Dependencies: []dependency{deps},
+	}
+	doc.Metadata.Timestamp = rec.Start.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []component{{Type: "application", BOMRef: "publish-go-lambda",
+		Name: "publish-go-lambda", PURL: "pkg:golang/github.com/artyom/publish-go-lambda"}}
+	doc.Metadata.Component = app
+	doc.Metadata.Properties = []property{
+		{"aws:lambda:function", rec.Function},
+		{"aws:lambda:version", rec.Version},
+		{"aws:lambda:codeSha256", rec.CodeSha256},
+	}
+	if rec.Commit != "" {
+		doc.Metadata.Properties = append(doc.Metadata.Properties, property{"git:commit", rec.Commit})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// splitQualifier splits function name or ARN into the unqualified one and
+// the qualifier, which is empty if there is none
+func splitQualifier(s string) (name, qualifier string) {
+	if strings.HasPrefix(s, "arn:") {
+		// arn:aws:lambda:region:account:function:name[:qualifier]
+		parts := strings.Split(s, ":")
+		n := min(7, len(parts))
+		return strings.Join(parts[:n], ":"), strings.Join(parts[n:], ":")
+	}
+	name, qualifier, _ = strings.Cut(s, ":")
+	return name, qualifier
+}
+
+func sbomCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("sbom", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	location := fs.String("location", "", "s3://bucket/prefix/ `URL` SBOMs were written to with -sbom flag")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s sbom -location s3://bucket/prefix/ aws-lambda-name:version\n\n",
+			filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Prints CycloneDX SBOM of the published function version, or the version alias\n"+
+			"points to, written on publish with -sbom flag.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	name, qualifier := splitQualifier(fs.Arg(0))
+	if name == "" || qualifier == "" {
+		return withExitCode(exitInvalid, errors.New("name with version or alias must be set, like my-function:42"))
+	}
+	store, err := parseVersionStore(*location)
+	if err != nil {
+		return withExitCode(exitInvalid, fmt.Errorf("-location: %w", err))
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	fn, err := lambda.NewFromConfig(cfg).GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: &name,
+		Qualifier:    &qualifier,
+	})
+	if err != nil {
+		return fmt.Errorf("GetFunctionConfiguration: %w", err)
+	}
+	key := store.key(aws.ToString(fn.FunctionArn), aws.ToString(fn.Version), sbomSuffix)
+	out, err := newS3Client(cfg).GetObject(ctx, &s3.GetObjectInput{Bucket: &store.bucket, Key: &key})
+	if err != nil {
+		return fmt.Errorf("S3 GetObject s3://%s/%s: %w", store.bucket, key, err)
+	}
+	defer out.Body.Close()
+	_, err = io.Copy(os.Stdout, out.Body)
+	return err
+}
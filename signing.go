@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/smithy-go"
+)
+
+// checkCodeSigning makes sure the package will not be rejected for the
+// lack of signature, before it is built: if function has a code signing
+// configuration that only accepts signed code, -signing-location must be
+// set, and the current version of the signing profile to sign the package
+// with must be one the configuration allows. The profile version to sign
+// with is kept in t.signingProfile.
+//
+// If the caller has no permission to read the code signing configuration,
+// the check is skipped, unless -signing-location is set.
+func (t *target) checkCodeSigning(ctx context.Context, args *runArgs) error {
+	if t.cfg == nil || t.imageRepo != "" {
+		return nil // to be created, or container image that cannot be signed
+	}
+	out, err := t.svc.GetFunctionCodeSigningConfig(ctx, &lambda.GetFunctionCodeSigningConfigInput{
+		FunctionName: &t.name,
+	})
+	var apiErr smithy.APIError
+	if args.signingLocation == nil && errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDeniedException" {
+		t.debugf("not checking code signing configuration: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("GetFunctionCodeSigningConfig: %w", err)
+	}
+	if aws.ToString(out.CodeSigningConfigArn) == "" {
+		return nil
+	}
+	csc, err := t.svc.GetCodeSigningConfig(ctx, &lambda.GetCodeSigningConfigInput{
+		CodeSigningConfigArn: out.CodeSigningConfigArn,
+	})
+	if err != nil {
+		return fmt.Errorf("GetCodeSigningConfig: %w", err)
+	}
+	c := csc.CodeSigningConfig
+	enforce := c.CodeSigningPolicies != nil && c.CodeSigningPolicies.UntrustedArtifactOnDeployment == types.CodeSigningPolicyEnforce
+	if args.signingLocation == nil {
+		if enforce {
+			return fmt.Errorf("function code signing configuration %s only accepts signed code,"+
+				" use -signing-location flag to sign it with AWS Signer", aws.ToString(c.CodeSigningConfigArn))
+		}
+		t.warnf("function code signing configuration %s warns about unsigned code, use -signing-location flag to sign it",
+			aws.ToString(c.CodeSigningConfigArn))
+		return nil
+	}
+	var allowed []string
+	if c.AllowedPublishers != nil {
+		allowed = c.AllowedPublishers.SigningProfileVersionArns
+	}
+	var problems []string
+	for _, arn := range allowed {
+		problem, err := t.checkSigningProfile(ctx, arn)
+		if err != nil {
+			return err
+		}
+		if problem == "" {
+			t.signingProfile = arn
+			return nil
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) == 0 {
+		problems = []string{"it allows no signing profiles"}
+	}
+	err = fmt.Errorf("cannot sign code for the function code signing configuration %s: %s",
+		aws.ToString(c.CodeSigningConfigArn), strings.Join(problems, "; "))
+	if enforce {
+		return err
+	}
+	t.warnf("%v, publishing unsigned code", err)
+	return nil
+}
+
+// checkSigningProfile describes the problem that prevents signing the code
+// with the signing profile version arn, or returns an empty string if there
+// is none: AWS Signer signs with the current version of the profile, so it
+// must be this version, the profile must be active, made for Lambda, and
+// accessible from the caller's account.
+func (t *target) checkSigningProfile(ctx context.Context, arn string) (string, error) {
+	name, owner, err := parseSigningProfileArn(arn)
+	if err != nil {
+		return "", err
+	}
+	var profile struct {
+		ProfileVersionArn string `json:"profileVersionArn"`
+		Status            string `json:"status"`
+		PlatformID        string `json:"platformId"`
+	}
+	err = callJSONAPI(ctx, t.awsCfg, "signer", t.awsCfg.Region, "https://signer."+t.awsCfg.Region+
+		".amazonaws.com/signing-profiles/"+url.PathEscape(name)+"?profileOwner="+url.QueryEscape(owner), nil, &profile)
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.status == "403 Forbidden":
+		return fmt.Sprintf("signing profile %s of the account %s is not accessible from this account", name, owner), nil
+	case errors.As(err, &apiErr) && apiErr.status == "404 Not Found":
+		return fmt.Sprintf("signing profile %s of the account %s does not exist in %s", name, owner, t.awsCfg.Region), nil
+	case err != nil:
+		return "", fmt.Errorf("Signer GetSigningProfile: %w", err)
+	case profile.Status != "Active":
+		return fmt.Sprintf("signing profile %s is %s", name, profile.Status), nil
+	case !strings.HasPrefix(profile.PlatformID, "AWSLambda-"):
+		return fmt.Sprintf("signing profile %s is for the %s platform, not Lambda", name, profile.PlatformID), nil
+	case profile.ProfileVersionArn != arn:
+		return fmt.Sprintf("current version of the signing profile %s is %s, but only %s is allowed",
+			name, profile.ProfileVersionArn, arn), nil
+	}
+	return "", nil
+}
+
+// signPackage uploads the package to loc, signs it with the signing profile
+// in an AWS Signer job, waits for the job to complete, and returns the S3
+// location of the signed package
+func (t *target) signPackage(ctx context.Context, loc *s3Location, profileArn string) (bucket, key string, err error) {
+	profile, owner, err := parseSigningProfileArn(profileArn)
+	if err != nil {
+		return "", "", err
+	}
+	key = t.packageKey(loc)
+	t.logf("uploading package to s3://%s/%s for signing", loc.bucket, key)
+	version, err := t.uploadPackage(ctx, loc.bucket, key)
+	if err != nil {
+		return "", "", err
+	}
+	if version == "" {
+		return "", "", fmt.Errorf("S3 bucket %s has no versioning enabled, AWS Signer requires it", loc.bucket)
+	}
+	type jobLocation struct {
+		BucketName string `json:"bucketName"`
+		Key        string `json:"key,omitempty"`
+		Version    string `json:"version,omitempty"`
+		Prefix     string `json:"prefix,omitempty"`
+	}
+	var job struct {
+		Source struct {
+			S3 jobLocation `json:"s3"`
+		} `json:"source"`
+		Destination struct {
+			S3 jobLocation `json:"s3"`
+		} `json:"destination"`
+		ProfileName        string `json:"profileName"`
+		ProfileOwner       string `json:"profileOwner"`
+		ClientRequestToken string `json:"clientRequestToken"`
+	}
+	job.Source.S3 = jobLocation{BucketName: loc.bucket, Key: key, Version: version}
+	job.Destination.S3 = jobLocation{BucketName: loc.bucket, Prefix: loc.prefix + aws.ToString(t.cfg.FunctionName) + "/signed-"}
+	job.ProfileName, job.ProfileOwner, job.ClientRequestToken = profile, owner, rand.Text()
+	endpoint := "https://signer." + t.awsCfg.Region + ".amazonaws.com/signing-jobs"
+	var started struct {
+		JobID string `json:"jobId"`
+	}
+	if err := callJSONAPI(ctx, t.awsCfg, "signer", t.awsCfg.Region, endpoint, &job, &started); err != nil {
+		return "", "", fmt.Errorf("Signer StartSigningJob: %w", err)
+	}
+	t.logf("signing package with the %s profile, job %s", profile, started.JobID)
+	delay := time.Second
+	for {
+		var status struct {
+			Status       string `json:"status"`
+			StatusReason string `json:"statusReason"`
+			SignedObject struct {
+				S3 jobLocation `json:"s3"`
+			} `json:"signedObject"`
+		}
+		if err := callJSONAPI(ctx, t.awsCfg, "signer", t.awsCfg.Region, endpoint+"/"+url.PathEscape(started.JobID),
+			nil, &status); err != nil {
+			return "", "", fmt.Errorf("Signer DescribeSigningJob: %w", err)
+		}
+		switch status.Status {
+		case "Succeeded":
+			return status.SignedObject.S3.BucketName, status.SignedObject.S3.Key, nil
+		case "Failed":
+			return "", "", fmt.Errorf("signing job %s failed: %s", started.JobID, status.StatusReason)
+		}
+		t.debugf("signing job is %s, checking again in %v", status.Status, delay)
+		select {
+		case <-ctx.Done():
+			return "", "", fmt.Errorf("waiting for the signing job: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 10*time.Second)
+	}
+}
+
+// parseSigningProfileArn returns the name and the owner account of the
+// signing profile version ARN, in the
+// arn:aws:signer:region:account:/signing-profiles/name/version format
+func parseSigningProfileArn(arn string) (name, owner string, err error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) == 6 {
+		fields := strings.Split(parts[5], "/")
+		if len(fields) == 4 && fields[1] == "signing-profiles" && fields[2] != "" {
+			return fields[2], parts[4], nil
+		}
+	}
+	return "", "", fmt.Errorf("unexpected signing profile version ARN %q", arn)
+}
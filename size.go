@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// byteSize is the size in bytes, set from the flag value with the optional
+// KB, MB, or GB unit; units are powers of 1024, as in Lambda quotas
+type byteSize int64
+
+func (s *byteSize) String() string {
+	switch {
+	case s == nil || *s == 0:
+		return ""
+	case *s%(1<<30) == 0:
+		return strconv.FormatInt(int64(*s>>30), 10) + "GB"
+	case *s%(1<<20) == 0:
+		return strconv.FormatInt(int64(*s>>20), 10) + "MB"
+	case *s%(1<<10) == 0:
+		return strconv.FormatInt(int64(*s>>10), 10) + "KB"
+	}
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *byteSize) Set(v string) error {
+	num, mult := strings.ToUpper(strings.TrimSpace(v)), 1.0
+	if n, ok := strings.CutSuffix(num, "IB"); ok {
+		num = n // like MiB
+	} else {
+		num = strings.TrimSuffix(num, "B")
+	}
+	for i, unit := range []string{"K", "M", "G"} {
+		if n, ok := strings.CutSuffix(num, unit); ok {
+			num, mult = strings.TrimSpace(n), float64(int64(1)<<(10*(i+1)))
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid size %q, want a number with optional KB, MB, or GB unit, like 20MB", v)
+	}
+	*s = byteSize(f * mult)
+	return nil
+}
+
+// checkSize fails if the package of the target is bigger than the -max-size
+// budget zipped, or -max-unzipped-size budget unzipped
+func (t *target) checkSize(args *runArgs) error {
+	if args.maxSize != 0 && t.pkg != nil && byteSize(t.pkg.size) > args.maxSize {
+		return fmt.Errorf("package is %s zipped, over the -max-size budget of %s",
+			sizeString(t.pkg.size), args.maxSize.String())
+	}
+	if args.maxUnzippedSize == 0 {
+		return nil
+	}
+	var total int64
+	for _, e := range t.entries {
+		fi, err := os.Stat(e.path)
+		if err != nil {
+			return err
+		}
+		total += fi.Size()
+	}
+	if byteSize(total) > args.maxUnzippedSize {
+		return fmt.Errorf("package is %s unzipped, over the -max-unzipped-size budget of %s",
+			sizeString(total), args.maxUnzippedSize.String())
+	}
+	return nil
+}
+
+// sizeString formats size in bytes in MB with a fraction
+func sizeString(n int64) string {
+	return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + "MB"
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+)
+
+// checkSSOSession makes sure that, if credentials come from the IAM Identity
+// Center (SSO) profile, its session has not expired. If it has, and program
+// runs interactively, it offers to run aws sso login, and checks credentials
+// again once login completes. Otherwise it returns an error telling the
+// command to log in with.
+//
+// Other credential errors are ignored here, they are reported by the first
+// API call.
+func checkSSOSession(ctx context.Context, cfg aws.Config) error {
+	profile := ssoProfile(ctx)
+	if profile == "" || cfg.Credentials == nil {
+		return nil
+	}
+	_, err := cfg.Credentials.Retrieve(ctx)
+	if err == nil || !expiredSSOSession(err) {
+		return nil
+	}
+	login := []string{"aws", "sso", "login"}
+	if profile != "default" {
+		login = append(login, "--profile", profile)
+	}
+	loginCmd := strings.Join(login, " ")
+	if _, lookErr := exec.LookPath("aws"); lookErr != nil || !interactive() ||
+		!confirm(fmt.Sprintf("AWS SSO session of the profile %q has expired, run %q now?", profile, loginCmd)) {
+		return withExitCode(exitAWS, fmt.Errorf("%w; to log in again, run: %s", err, loginCmd))
+	}
+	cmd := exec.CommandContext(ctx, login[0], login[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return withExitCode(exitAWS, fmt.Errorf("%s: %w", loginCmd, err))
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return withExitCode(exitAWS, fmt.Errorf("retrieving credentials after SSO login: %w", err))
+	}
+	return nil
+}
+
+// ssoProfile returns name of the shared configuration profile in use if it
+// gets credentials from the IAM Identity Center, or an empty string otherwise
+func ssoProfile(ctx context.Context) string {
+	profile := awsFlags.profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	sc, err := config.LoadSharedConfigProfile(ctx, profile)
+	if err != nil || (sc.SSOSessionName == "" && sc.SSOStartURL == "") {
+		return ""
+	}
+	return profile
+}
+
+// expiredSSOSession reports whether err tells that the SSO session has expired
+// or its token is otherwise unusable
+func expiredSSOSession(err error) bool {
+	var tokenErr *ssocreds.InvalidTokenError
+	var authErr *ssotypes.UnauthorizedException
+	// with the sso-session configuration, token provider errors are not typed
+	return errors.As(err, &tokenErr) || errors.As(err, &authErr) || strings.Contains(err.Error(), "SSO token")
+}
+
+// interactive reports whether stdin is a terminal
+func interactive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks question on stderr and reports whether user answered yes
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultStampVars is the default value of the -stamp-vars flag
+const defaultStampVars = "version=main.version,commit=main.commit,time=main.buildTime"
+
+// parseStampVars parses -stamp-vars flag value: comma-separated list of
+// key=pkg.Var pairs, where key is one of version, commit, or time
+func parseStampVars(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, kv := range splitList(s) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.Contains(v, ".") {
+			return nil, fmt.Errorf("invalid -stamp-vars element %q, want key=pkg.Var", kv)
+		}
+		switch k {
+		case "version", "commit", "time":
+		default:
+			return nil, fmt.Errorf("invalid -stamp-vars key %q, want version, commit, or time", k)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// stampVars returns -X linker flag values describing the git state of dir:
+// git describe output, commit SHA, and build time. If the working tree is
+// clean, commit time is used as build time, so that the same sources produce
+// the same binary, and unchanged function is not republished. If dir is not
+// inside a git repository, it returns nil.
+func stampVars(ctx context.Context, dir string, vars map[string]string) []string {
+	if len(vars) == 0 {
+		return nil
+	}
+	git := func(args ...string) (string, error) { return gitOutput(ctx, dir, args...) }
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+	values := map[string]string{"commit": commit}
+	if values["version"], err = git("describe", "--tags", "--always", "--dirty"); err != nil {
+		return nil
+	}
+	buildTime := time.Now().UTC()
+	if !strings.HasSuffix(values["version"], "-dirty") {
+		if s, err := git("log", "-1", "--format=%ct"); err == nil {
+			var sec int64
+			if _, err := fmt.Sscan(s, &sec); err == nil {
+				buildTime = time.Unix(sec, 0).UTC()
+			}
+		}
+	}
+	values["time"] = buildTime.Format(time.RFC3339)
+	var out []string
+	for _, k := range []string{"version", "commit", "time"} {
+		if v, ok := vars[k]; ok {
+			out = append(out, v+"="+values[k])
+		}
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// tail prints function log events logged after the since time to stdout
+// until ctx is canceled
+func (t *target) tail(ctx context.Context, since time.Time) error {
+	group := t.logGroup()
+	t.logf("streaming logs from %s, interrupt to stop", group)
+	return tailLogs(ctx, cloudwatchlogs.NewFromConfig(t.awsCfg), group, since)
+}
+
+// logGroup returns name of the CloudWatch Logs log group function logs to
+func (t *target) logGroup() string {
+	if t.cfg == nil {
+		return "/aws/lambda/" + t.name // to be created
+	}
+	if t.cfg.LoggingConfig != nil && t.cfg.LoggingConfig.LogGroup != nil {
+		return *t.cfg.LoggingConfig.LogGroup
+	}
+	return "/aws/lambda/" + aws.ToString(t.cfg.FunctionName)
+}
+
+func tailLogs(ctx context.Context, svc *cloudwatchlogs.Client, group string, since time.Time) error {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	start := since.UnixMilli()
+	// events logged at the start time that are already printed
+	seen := make(map[string]struct{})
+	for {
+		// start stays the same while pages are fetched, the next query
+		// starts from the latest event printed
+		next, nextSeen := start, maps.Clone(seen)
+		var token *string
+		for {
+			out, err := svc.FilterLogEvents(ctx, &cloudwatchlogs.FilterLogEventsInput{
+				LogGroupName: &group,
+				StartTime:    &start,
+				NextToken:    token,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				var notFound *cwltypes.ResourceNotFoundException
+				if errors.As(err, &notFound) {
+					break // log group is created on the first invocation
+				}
+				return fmt.Errorf("FilterLogEvents: %w", err)
+			}
+			for _, e := range out.Events {
+				id, ts := aws.ToString(e.EventId), aws.ToInt64(e.Timestamp)
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				if ts > next {
+					next = ts
+					clear(nextSeen)
+				}
+				if ts == next {
+					nextSeen[id] = struct{}{}
+				}
+				msg := aws.ToString(e.Message)
+				if !strings.HasSuffix(msg, "\n") {
+					msg += "\n"
+				}
+				os.Stdout.WriteString(msg)
+			}
+			if token = out.NextToken; token == nil {
+				break
+			}
+		}
+		start, seen = next, nextSeen
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// tracingSDKs are prefixes of import paths of packages that send traces to
+// X-Ray from the function code, directly or through the ADOT collector
+var tracingSDKs = []string{
+	"github.com/aws/aws-xray-sdk-go",
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace",
+	"go.opentelemetry.io/contrib/propagators/aws/xray",
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda/xrayconfig",
+}
+
+// parseTracingMode parses -tracing flag value
+func parseTracingMode(s string) (types.TracingMode, error) {
+	for _, m := range types.TracingMode("").Values() {
+		if strings.EqualFold(s, string(m)) {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported tracing mode %q, want either active or passthrough", s)
+}
+
+// checkTracing warns if the function tracing mode, the one it is going to
+// have after the deploy, does not fit the code: X-Ray SDK used without
+// Active tracing does not get sampled requests, and Active tracing without
+// an SDK only records the Lambda service segments
+func (t *target) checkTracing(args *runArgs, imports []string) {
+	mode := args.tracing
+	switch {
+	case mode == "" && args.adot != "":
+		mode = types.TracingModeActive // see enableADOT
+	case mode == "":
+		mode = t.tracingMode()
+	}
+	i := slices.IndexFunc(imports, func(p string) bool {
+		return slices.ContainsFunc(tracingSDKs, func(sdk string) bool { return p == sdk || strings.HasPrefix(p, sdk+"/") })
+	})
+	switch {
+	case i != -1 && mode != types.TracingModeActive:
+		t.warnf("code imports %s, but function tracing mode is %s, so its traces are not sampled;"+
+			" use -tracing active flag to enable tracing", imports[i], mode)
+	case i == -1 && mode == types.TracingModeActive:
+		t.warnf("function has Active tracing, but code does not import an X-Ray or OpenTelemetry SDK," +
+			" so only the Lambda service segments are recorded")
+	}
+}
+
+// tracingMode returns the current tracing mode of the function
+func (t *target) tracingMode() types.TracingMode {
+	if t.cfg.TracingConfig == nil || t.cfg.TracingConfig.Mode == "" {
+		return types.TracingModePassThrough
+	}
+	return t.cfg.TracingConfig.Mode
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// retryConflicts calls fn, and, while it fails with ResourceConflictException
+// because another update of the function is still in progress, waits for that
+// update to complete and calls fn again, with growing delays, until ctx is
+// done
+func (t *target) retryConflicts(ctx context.Context, fn func() error) error {
+	delay := time.Second
+	for {
+		err := fn()
+		var conflict *types.ResourceConflictException
+		if !errors.As(err, &conflict) {
+			return err
+		}
+		t.logf("another update of the function is in progress, waiting for it to complete")
+		w := lambda.NewFunctionUpdatedV2Waiter(t.svc)
+		if werr := w.Wait(ctx, &lambda.GetFunctionInput{FunctionName: &t.name}, maxWait(ctx)); werr != nil {
+			return fmt.Errorf("%w; waiting for the update in progress: %w", err, werr)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// retryStale calls fn, and, if it fails with PreconditionFailedException
+// because the function changed since its configuration was fetched, fetches
+// configuration again and calls fn again, up to a few times. It fails if the
+// function now needs a different package, like the one for another
+// architecture.
+func (t *target) retryStale(ctx context.Context, args *runArgs, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var stale *types.PreconditionFailedException
+		if !errors.As(err, &stale) || attempt == 3 {
+			return err
+		}
+		t.logf("function changed since its configuration was fetched, fetching it again")
+		fresh := &target{name: t.name, awsCfg: t.awsCfg, svc: t.svc}
+		if err := fresh.resolve(ctx, args); err != nil {
+			return fmt.Errorf("fetching changed function configuration: %w", err)
+		}
+		if fresh.cfg == nil {
+			return errors.New("function was deleted during the deploy")
+		}
+		if fresh.arch != t.arch || fresh.binaryName != t.binaryName || fresh.imageRepo != t.imageRepo {
+			return fmt.Errorf("function configuration changed during the deploy, package built for %s with the %q binary"+
+				" no longer fits it", t.arch, t.binaryName)
+		}
+		t.cfg = fresh.cfg
+	}
+}
+
+// waitUpdated polls configuration of the function's $LATEST version until its
+// last update completes. If update failed, it returns an error with the
+// reason Lambda reports, like the image that cannot be pulled, or the lack of
+// ENIs in the VPC. On success it returns the updated configuration.
+func (t *target) waitUpdated(ctx context.Context) (*lambda.GetFunctionConfigurationOutput, error) {
+	delay := time.Second
+	for {
+		cfg, err := t.svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+			FunctionName: &t.name,
+			Qualifier:    aws.String("$LATEST"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetFunctionConfiguration: %w", err)
+		}
+		switch cfg.LastUpdateStatus {
+		case types.LastUpdateStatusSuccessful, "":
+			return cfg, nil
+		case types.LastUpdateStatusFailed:
+			return nil, fmt.Errorf("function update failed: %s (%s)", aws.ToString(cfg.LastUpdateStatusReason), cfg.LastUpdateStatusReasonCode)
+		}
+		t.debugf("function update is %s, checking again in %v", cfg.LastUpdateStatus, delay)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the function update: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 10*time.Second)
+	}
+}
+
+// waitActive makes sure the function is in the Active state before its code
+// is updated, waiting up to timeout while it is Pending, like right after
+// creation, or while Lambda sets up its VPC network interfaces. It fails if
+// function is Inactive or Failed, with the reason Lambda reports. Once
+// function becomes active, t.cfg is refreshed.
+func (t *target) waitActive(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cfg := t.cfg
+	delay := time.Second
+	for {
+		switch cfg.State {
+		case types.StateActive, "":
+			t.cfg = cfg
+			return nil
+		case types.StatePending:
+			if cfg == t.cfg {
+				t.logf("function is pending (%s), waiting for it to become active", aws.ToString(cfg.StateReason))
+			}
+		case types.StateInactive:
+			return fmt.Errorf("function is inactive (%s); invoke it to make Lambda reactivate it, then try again",
+				aws.ToString(cfg.StateReason))
+		default:
+			return fmt.Errorf("function is in the %s state: %s (%s)", cfg.State, aws.ToString(cfg.StateReason), cfg.StateReasonCode)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for the function to become active: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 10*time.Second)
+		var err error
+		if cfg, err = t.svc.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+			FunctionName: &t.name,
+			Qualifier:    aws.String("$LATEST"),
+		}); err != nil {
+			return fmt.Errorf("GetFunctionConfiguration: %w", err)
+		}
+	}
+}
+
+// maxWait returns the time left until ctx deadline, to limit waiters with; if
+// ctx has no deadline, it returns the default of 5 minutes
+func maxWait(ctx context.Context) time.Duration {
+	if d, ok := ctx.Deadline(); ok {
+		return time.Until(d)
+	}
+	return 5 * time.Minute
+}
+
+// syncResources updates function memory size, ephemeral storage size,
+// timeout, and tracing mode to the ones set with -memory, -ephemeral-storage,
+// -timeout-config, and -tracing flags, if they differ, so that the new code
+// gets the resources and tracing it needs from its first invocation
+func (t *target) syncResources(ctx context.Context, args *runArgs) error {
+	in := new(lambda.UpdateFunctionConfigurationInput)
+	var changes []string
+	if args.memory != 0 && aws.ToInt32(t.cfg.MemorySize) != args.memory {
+		changes = append(changes, fmt.Sprintf("memory size from %d to %d MB", aws.ToInt32(t.cfg.MemorySize), args.memory))
+		in.MemorySize = &args.memory
+	}
+	if size := t.ephemeralStorage(); args.ephemeralStorage != 0 && size != args.ephemeralStorage {
+		changes = append(changes, fmt.Sprintf("ephemeral storage size from %d to %d MB", size, args.ephemeralStorage))
+		in.EphemeralStorage = &types.EphemeralStorage{Size: &args.ephemeralStorage}
+	}
+	if timeout := int32(args.functionTimeout / time.Second); timeout != 0 && aws.ToInt32(t.cfg.Timeout) != timeout {
+		changes = append(changes, fmt.Sprintf("timeout from %ds to %ds", aws.ToInt32(t.cfg.Timeout), timeout))
+		in.Timeout = &timeout
+	}
+	if mode := t.tracingMode(); args.tracing != "" && mode != args.tracing {
+		changes = append(changes, fmt.Sprintf("tracing mode from %s to %s", mode, args.tracing))
+		in.TracingConfig = &types.TracingConfig{Mode: args.tracing}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if args.dryRun {
+		t.logf("dry run, would update %s", strings.Join(changes, ", "))
+		return nil
+	}
+	t.logf("updating %s", strings.Join(changes, ", "))
+	return t.updateConfiguration(ctx, in)
+}
+
+// ephemeralStorage returns the size of the function /tmp directory in MB
+func (t *target) ephemeralStorage() int32 {
+	if t.cfg.EphemeralStorage == nil || t.cfg.EphemeralStorage.Size == nil {
+		return 512 // the default
+	}
+	return *t.cfg.EphemeralStorage.Size
+}
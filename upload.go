@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Location is the S3 bucket and key prefix to upload packages to, either
+// for signing with AWS Signer, which also writes the signed packages there,
+// or for Lambda to take the code from. Bucket must be in the region of the
+// function.
+type s3Location struct {
+	bucket string
+	prefix string
+}
+
+// parseS3Location parses -signing-location or -upload-location flag value,
+// an s3://bucket/prefix/ URL
+func parseS3Location(s string) (*s3Location, error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q, want s3://bucket/prefix/", s)
+	}
+	return &s3Location{bucket: bucket, prefix: prefix}, nil
+}
+
+// packageFile is the deployment package written to disk. Packages are not
+// kept in memory, as they may be up to 50MB each, and the SDK makes yet
+// another base64-encoded copy to send them.
+type packageFile struct {
+	path string
+	size int64
+	sum  [sha256.Size]byte // SHA-256 of the file content
+}
+
+// zipToFile creates a zip archive from given entries in the new file at
+// path, see writeZip
+func zipToFile(path string, entries []zipEntry, c compression, logf func(format string, args ...any)) (*packageFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(f, h)}
+	if err := writeZip(cw, entries, c, logf); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	p := &packageFile{path: path, size: cw.n}
+	h.Sum(p.sum[:0])
+	return p, nil
+}
+
+// len returns the package size, 0 for the nil package of Image type
+// functions
+func (p *packageFile) len() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.size
+}
+
+// codeSha256 returns SHA-256 of the package the way Lambda reports it, base64
+// encoded
+func (p *packageFile) codeSha256() string { return base64.StdEncoding.EncodeToString(p.sum[:]) }
+
+// copyTo copies the package to the file at path
+func (p *packageFile) copyTo(path string) error {
+	src, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// code returns the package to create or update the function with: with
+// -upload-location the package is streamed to S3 first, and Lambda takes it
+// from there, otherwise it is sent within the request
+func (t *target) code(ctx context.Context, args *runArgs) (*types.FunctionCode, error) {
+	if args.uploadLocation == nil {
+		b, err := os.ReadFile(t.pkg.path)
+		if err != nil {
+			return nil, err
+		}
+		return &types.FunctionCode{ZipFile: b}, nil
+	}
+	key := t.packageKey(args.uploadLocation)
+	t.debugf("uploading package to s3://%s/%s", args.uploadLocation.bucket, key)
+	version, err := t.uploadPackage(ctx, args.uploadLocation.bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	code := &types.FunctionCode{S3Bucket: &args.uploadLocation.bucket, S3Key: &key}
+	if version != "" {
+		code.S3ObjectVersion = &version
+	}
+	return code, nil
+}
+
+// packageKey returns the S3 key to upload the package to under loc, named
+// after the function and the package SHA-256, so that the same package is
+// always uploaded to the same key
+func (t *target) packageKey(loc *s3Location) string {
+	name := t.name
+	if t.cfg != nil {
+		name = aws.ToString(t.cfg.FunctionName)
+	}
+	return loc.prefix + name + "/" + hex.EncodeToString(t.pkg.sum[:]) + ".zip"
+}
+
+// uploadPackage streams the package from disk to the S3 object with target
+// credentials, returning the object version, empty if the bucket has no
+// versioning enabled
+func (t *target) uploadPackage(ctx context.Context, bucket, key string) (string, error) {
+	f, err := os.Open(t.pkg.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	out, err := newS3Client(t.awsCfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &bucket,
+		Key:           &key,
+		Body:          f,
+		ContentLength: &t.pkg.size,
+		ContentType:   aws.String("application/zip"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("S3 PutObject: %w", err)
+	}
+	return aws.ToString(out.VersionId), nil
+}
+
+// countingWriter counts bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// upxLevel is the compression level for UPX, set with -upx flag: 0 disables
+// compression, -1 stands for the UPX default level, 10 for --best
+type upxLevel int
+
+func (l *upxLevel) String() string {
+	switch {
+	case l == nil || *l == 0:
+		return ""
+	case *l < 0:
+		return "true"
+	case *l > 9:
+		return "best"
+	}
+	return strconv.Itoa(int(*l))
+}
+
+func (l *upxLevel) Set(s string) error {
+	switch s {
+	case "true":
+		*l = -1
+		return nil
+	case "false":
+		*l = 0
+		return nil
+	case "best":
+		*l = 10
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 9 {
+		return fmt.Errorf("invalid UPX level %q, want 1-9 or best", s)
+	}
+	*l = upxLevel(n)
+	return nil
+}
+
+func (l *upxLevel) IsBoolFlag() bool { return true }
+
+// upxCompress compresses binary with UPX, returning path to the compressed
+// file, which is created in dir. If upx is not installed, it logs a warning
+// and returns the original path.
+func upxCompress(binPath, dir string, level upxLevel) (string, error) {
+	upx, err := exec.LookPath("upx")
+	if err != nil {
+		slog.Warn(fmt.Sprintf("upx not found, publishing uncompressed binary: %v", err))
+		return binPath, nil
+	}
+	slog.Info("compressing binary with UPX: this makes the package smaller at the cost of" +
+		" decompressing the binary on each cold start")
+	dst := filepath.Join(dir, filepath.Base(binPath)+".upx")
+	cmdArgs := []string{"-q", "-o", dst}
+	switch {
+	case level > 9:
+		cmdArgs = append(cmdArgs, "--best")
+	case level > 0:
+		cmdArgs = append(cmdArgs, "-"+strconv.Itoa(int(level)))
+	}
+	cmd := exec.Command(upx, append(cmdArgs, binPath)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running upx: %w", err)
+	}
+	return dst, nil
+}
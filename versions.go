@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// publishedVersions returns all published function versions (i.e. excluding
+// $LATEST), sorted by version number in ascending order
+func publishedVersions(ctx context.Context, svc *lambda.Client, name string) ([]types.FunctionConfiguration, error) {
+	var out []types.FunctionConfiguration
+	p := lambda.NewListVersionsByFunctionPaginator(svc, &lambda.ListVersionsByFunctionInput{FunctionName: &name})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListVersionsByFunction: %w", err)
+		}
+		for _, v := range page.Versions {
+			if _, err := versionNumber(aws.ToString(v.Version)); err == nil {
+				out = append(out, v)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := versionNumber(aws.ToString(out[i].Version))
+		b, _ := versionNumber(aws.ToString(out[j].Version))
+		return a < b
+	})
+	return out, nil
+}
+
+// versionNumber parses published function version
+func versionNumber(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) }
+
+// previousVersion returns the latest of versions that is older than the
+// current one and has code different from the given CodeSha256. Versions must
+// be sorted in ascending order. If current is empty, all versions are
+// considered.
+func previousVersion(versions []types.FunctionConfiguration, current, codeSha256 string) (string, error) {
+	var cur uint64
+	if current != "" {
+		var err error
+		if cur, err = versionNumber(current); err != nil {
+			return "", fmt.Errorf("%q is not a published version", current)
+		}
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		n, _ := versionNumber(aws.ToString(v.Version))
+		if current != "" && n >= cur {
+			continue
+		}
+		if aws.ToString(v.CodeSha256) != codeSha256 {
+			return aws.ToString(v.Version), nil
+		}
+	}
+	return "", fmt.Errorf("cannot find a version older than %q with different code", current)
+}
+
+func versionsCmd(ctx context.Context, argv []string) error {
+	fs := flag.NewFlagSet("versions", flag.ExitOnError)
+	registerLogFlags(fs)
+	registerAWSFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s versions aws-lambda-name\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "Lists published function versions along with the aliases pointing to them.\n")
+	}
+	fs.Parse(argv)
+	name := fs.Arg(0)
+	if name == "" {
+		return withExitCode(exitInvalid, errors.New("name must be set"))
+	}
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	svc := lambda.NewFromConfig(cfg)
+	versions, err := publishedVersions(ctx, svc, name)
+	if err != nil {
+		return err
+	}
+	aliases, err := versionAliases(ctx, svc, name)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tPUBLISHED\tSIZE\tSHA256\tALIASES\tDESCRIPTION")
+	for _, v := range versions {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			aws.ToString(v.Version),
+			aws.ToString(v.LastModified),
+			v.CodeSize,
+			aws.ToString(v.CodeSha256),
+			strings.Join(aliases[aws.ToString(v.Version)], ","),
+			aws.ToString(v.Description),
+		)
+	}
+	return tw.Flush()
+}
+
+// versionAliases maps function versions to the names of aliases pointing to
+// them. Aliases routing some share of traffic to the version have this share
+// mentioned, like "live(10%)".
+func versionAliases(ctx context.Context, svc *lambda.Client, name string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	p := lambda.NewListAliasesPaginator(svc, &lambda.ListAliasesInput{FunctionName: &name})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListAliases: %w", err)
+		}
+		for _, a := range page.Aliases {
+			version := aws.ToString(a.FunctionVersion)
+			if a.RoutingConfig == nil || len(a.RoutingConfig.AdditionalVersionWeights) == 0 {
+				out[version] = append(out[version], aws.ToString(a.Name))
+				continue
+			}
+			// weights are rounded to float32 precision, so that 1-0.1 shows as
+			// 90%, not 90.00000000000001%
+			share := func(w float64) string {
+				return aws.ToString(a.Name) + "(" + strconv.FormatFloat(w*100, 'f', -1, 32) + "%)"
+			}
+			var rest float64 = 1
+			for v, w := range a.RoutingConfig.AdditionalVersionWeights {
+				out[v] = append(out[v], share(w))
+				rest -= w
+			}
+			out[version] = append(out[version], share(rest))
+		}
+	}
+	for _, names := range out {
+		sort.Strings(names)
+	}
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// vpcEndpointNames maps AWS SDK service packages to the names of their VPC
+// endpoint services, where these differ
+var vpcEndpointNames = map[string]string{
+	"cloudwatchlogs": "logs",
+	"eventbridge":    "events",
+	"sfn":            "states",
+	"cloudwatch":     "monitoring",
+}
+
+// checkVPC makes sure subnets and security groups of the VPC-attached
+// function still exist, as otherwise Lambda fails to update it. If code
+// imports AWS SDK service clients, it warns about the services the function
+// cannot reach: functions in VPC have no internet access unless their
+// subnets route it through a NAT gateway, so each service then needs a VPC
+// endpoint.
+func (t *target) checkVPC(ctx context.Context, args *runArgs, imports []string) error {
+	vpc := t.cfg.VpcConfig
+	if vpc == nil || len(vpc.SubnetIds) == 0 {
+		return nil
+	}
+	if args.wait {
+		t.logf("function is attached to %s, its update may take a few minutes while Lambda sets up network interfaces",
+			aws.ToString(vpc.VpcId))
+	}
+	svc := ec2.NewFromConfig(t.awsCfg)
+	subnets, err := svc.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("subnet-id"), Values: vpc.SubnetIds}},
+	})
+	if err != nil {
+		return fmt.Errorf("DescribeSubnets: %w", err)
+	}
+	if missing := missingIDs(vpc.SubnetIds, subnets.Subnets, func(s ec2types.Subnet) string {
+		return aws.ToString(s.SubnetId)
+	}); len(missing) != 0 {
+		return fmt.Errorf("function subnets no longer exist: %s", strings.Join(missing, ", "))
+	}
+	if len(vpc.SecurityGroupIds) != 0 {
+		groups, err := svc.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+			Filters: []ec2types.Filter{{Name: aws.String("group-id"), Values: vpc.SecurityGroupIds}},
+		})
+		if err != nil {
+			return fmt.Errorf("DescribeSecurityGroups: %w", err)
+		}
+		if missing := missingIDs(vpc.SecurityGroupIds, groups.SecurityGroups, func(g ec2types.SecurityGroup) string {
+			return aws.ToString(g.GroupId)
+		}); len(missing) != 0 {
+			return fmt.Errorf("function security groups no longer exist: %s", strings.Join(missing, ", "))
+		}
+	}
+	services := sdkServices(imports)
+	if len(services) == 0 {
+		return nil
+	}
+	nat, err := hasNATRoute(ctx, svc, aws.ToString(vpc.VpcId), vpc.SubnetIds)
+	if err != nil || nat {
+		return err
+	}
+	endpoints, err := svc.DescribeVpcEndpoints(ctx, &ec2.DescribeVpcEndpointsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{aws.ToString(vpc.VpcId)}}},
+	})
+	if err != nil {
+		return fmt.Errorf("DescribeVpcEndpoints: %w", err)
+	}
+	var unreachable []string
+	for _, s := range services {
+		name := s
+		if n, ok := vpcEndpointNames[s]; ok {
+			name = n
+		}
+		if !slices.ContainsFunc(endpoints.VpcEndpoints, func(e ec2types.VpcEndpoint) bool {
+			return strings.HasSuffix(aws.ToString(e.ServiceName), "."+name)
+		}) {
+			unreachable = append(unreachable, s)
+		}
+	}
+	if len(unreachable) != 0 {
+		t.warnf("function is attached to %s, which subnets have no route through a NAT gateway, and code uses AWS SDK"+
+			" clients of the services the VPC has no endpoints for: %s; calls to them will time out",
+			aws.ToString(vpc.VpcId), strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// sdkServices returns sorted names of the AWS SDK for Go v2 service packages
+// from imports, like "s3" or "dynamodb"
+func sdkServices(imports []string) []string {
+	const prefix = "github.com/aws/aws-sdk-go-v2/service/"
+	var out []string
+	for _, p := range imports {
+		name, ok := strings.CutPrefix(p, prefix)
+		if !ok || strings.Contains(name, "/") || name == "sso" || name == "ssooidc" {
+			continue // internal packages, and clients used for credentials only
+		}
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// hasNATRoute reports whether all the subnets have a default route through a
+// NAT gateway, or another target that is not an internet gateway, which does
+// not give internet access to Lambda network interfaces
+func hasNATRoute(ctx context.Context, svc *ec2.Client, vpcID string, subnets []string) (bool, error) {
+	out, err := svc.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("vpc-id"), Values: []string{vpcID}}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("DescribeRouteTables: %w", err)
+	}
+	tables := make(map[string]ec2types.RouteTable) // by subnet, "" for the main one
+	for _, rt := range out.RouteTables {
+		for _, a := range rt.Associations {
+			switch {
+			case aws.ToBool(a.Main):
+				tables[""] = rt
+			case a.SubnetId != nil:
+				tables[*a.SubnetId] = rt
+			}
+		}
+	}
+	for _, id := range subnets {
+		rt, ok := tables[id]
+		if !ok {
+			rt = tables[""]
+		}
+		if !slices.ContainsFunc(rt.Routes, func(r ec2types.Route) bool {
+			return aws.ToString(r.DestinationCidrBlock) == "0.0.0.0/0" && r.State != ec2types.RouteStateBlackhole &&
+				!strings.HasPrefix(aws.ToString(r.GatewayId), "igw-")
+		}) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// missingIDs returns ids that none of the items has
+func missingIDs[T any](ids []string, items []T, id func(T) string) []string {
+	var out []string
+	for _, s := range ids {
+		if !slices.ContainsFunc(items, func(item T) bool { return id(item) == s }) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
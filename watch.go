@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watch calls fn, then calls it again each time files of the Go package in
+// dir or any of its dependencies from the local modules are changed. Errors
+// returned by fn are logged. It only returns once ctx is canceled.
+func watch(ctx context.Context, dir string, tags []string, fn func() error) error {
+	const (
+		pollInterval = 500 * time.Millisecond
+		debounce     = time.Second // how long files must stay unchanged
+	)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var prev dirSnapshot
+	for {
+		if err := fn(); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error(err.Error())
+		}
+		var dirs []string
+		if deps, err := localDeps(ctx, dir, tags); err != nil {
+			slog.Warn(fmt.Sprintf("listing package dependencies: %v", err))
+		} else {
+			dirs = deps.watchDirs()
+		}
+		switch {
+		case len(dirs) != 0:
+			prev = snapshot(dirs)
+		case prev.files == nil:
+			prev = snapshot([]string{dir})
+		}
+		slog.Info(fmt.Sprintf("watching %d directories for changes", len(prev.dirs)))
+		var lastChange time.Time
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case now := <-ticker.C:
+				cur := snapshot(prev.dirs)
+				if !cur.equal(prev) {
+					prev, lastChange = cur, now
+					continue
+				}
+				if !lastChange.IsZero() && now.Sub(lastChange) >= debounce {
+					break wait
+				}
+			}
+		}
+	}
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// dirSnapshot records state of files in a set of directories
+type dirSnapshot struct {
+	dirs  []string
+	files map[string]fileState
+}
+
+func snapshot(dirs []string) dirSnapshot {
+	s := dirSnapshot{dirs: dirs, files: make(map[string]fileState)}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				continue
+			}
+			s.files[filepath.Join(dir, e.Name())] = fileState{size: fi.Size(), modTime: fi.ModTime()}
+		}
+	}
+	return s
+}
+
+func (s dirSnapshot) equal(other dirSnapshot) bool {
+	if len(s.files) != len(other.files) {
+		return false
+	}
+	for k, v := range s.files {
+		if w, ok := other.files[k]; !ok || !v.modTime.Equal(w.modTime) || v.size != w.size {
+			return false
+		}
+	}
+	return true
+}